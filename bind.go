@@ -0,0 +1,250 @@
+package sqlmaper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrMissingParam - a parameter of the query without value in the bound argument
+	ErrMissingParam = errors.New("missing bind parameter")
+	// ErrUnusedParam - a value of the bound map that is not a parameter of the query
+	ErrUnusedParam = errors.New("unused bind parameter")
+	// ErrInvalidParam - a value that could not be converted to the type declared for its parameter
+	ErrInvalidParam = errors.New("invalid bind parameter")
+)
+
+// BindStyle is the kind of placeholder that a database driver expects for the bind parameters
+type BindStyle int
+
+const (
+	// NamedBind - :name, the parameters are kept as they are in the file
+	NamedBind BindStyle = iota
+	// QuestionBind - ? (mysql, sqlite)
+	QuestionBind
+	// DollarBind - $1, $2 (postgres: lib/pq, pgx)
+	DollarBind
+	// AtBind - @p1, @p2 (sql server)
+	AtBind
+	// ColonBind - :1, :2 (oracle)
+	ColonBind
+)
+
+var bindStyleNames = []string{"NamedBind", "QuestionBind", "DollarBind", "AtBind", "ColonBind"}
+
+// String satisfy stringer interface
+func (b BindStyle) String() string {
+	if b >= 0 && int(b) < len(bindStyleNames) {
+		return bindStyleNames[b]
+	}
+	return fmt.Sprintf("BindStyle(%d)", int(b))
+}
+
+var driverBindStyles = map[string]BindStyle{
+	"postgres":  DollarBind,
+	"pgx":       DollarBind,
+	"mysql":     QuestionBind,
+	"sqlite3":   QuestionBind,
+	"sqlite":    QuestionBind,
+	"sqlserver": AtBind,
+	"mssql":     AtBind,
+	"oracle":    ColonBind,
+	"godror":    ColonBind,
+	"goracle":   ColonBind,
+	"oci8":      ColonBind,
+}
+
+// DriverBindStyle returns the bind style of a database/sql driver given the name it was registered
+// with (eg: "postgres", "mysql", "sqlserver" or "godror"), false is returned for an unknown driver
+func DriverBindStyle(driverName string) (BindStyle, bool) {
+	b, ok := driverBindStyles[strings.ToLower(driverName)]
+	return b, ok
+}
+
+// Rebind returns the statement with its named parameters turned into the placeholders of the bind
+// style along with the names of the arguments in the order they must be given to the driver.
+// Every placeholder is a different argument, so a parameter used twice appears twice in the names.
+// The statement is not escaped (the colons are not doubled), it's meant to be used with database/sql
+func (q Query) Rebind(style BindStyle) (string, []string) {
+	var (
+		str   strings.Builder
+		names []string
+	)
+	walkParams(q.Raw(), q.backslash, func(tok token, name string) {
+		if name == "" {
+			str.WriteString(tok.Text)
+			return
+		}
+		names = append(names, name)
+		switch style {
+		case QuestionBind:
+			str.WriteString("?")
+		case DollarBind:
+			str.WriteString("$" + strconv.Itoa(len(names)))
+		case AtBind:
+			str.WriteString("@p" + strconv.Itoa(len(names)))
+		case ColonBind:
+			str.WriteString(":" + strconv.Itoa(len(names)))
+		default:
+			str.WriteString(tok.Text)
+		}
+	})
+	return str.String(), names
+}
+
+// Bind returns the statement with the placeholders of the bind style and the arguments to execute it,
+// the values of the parameters are taken from a map with string keys or from a struct (or a pointer to
+// a struct) whose fields are matched by their db tag (`db:"refDate"`) or by their name.
+// The names are matched exactly and then ignoring the case. A parameter without value is an
+// ErrMissingParam and a key of the map that is not a parameter is an ErrUnusedParam (the fields of
+// a struct could be left unused). With NamedBind the arguments are sql.NamedArg values.
+// The parameters declared with a param tag are converted to their type (ErrInvalidParam if they
+// could not be), they take their default value when they are not given and they are nil unless
+// they are required (a required parameter without value or nil is an ErrMissingParam)
+func (q Query) Bind(style BindStyle, arg interface{}) (string, []interface{}, error) {
+	stmt, names := q.Rebind(style)
+	values, isMap, err := bindValues(arg)
+	if err != nil {
+		return "", nil, fmt.Errorf("query %q: %w", q.Tags["name"], err)
+	}
+
+	var (
+		args    = make([]interface{}, 0, len(names))
+		used    = make(map[string]bool, len(names))
+		missed  = make(map[string]bool)
+		missing []string
+	)
+	for _, name := range names {
+		spec, declared := q.ParamSpec(name)
+		key, ok := lookupKey(values, name)
+		var v interface{}
+		switch {
+		case ok:
+			used[key] = true
+			v = values[key]
+		case spec.HasDefault:
+			v = spec.Default
+		}
+
+		if declared {
+			if v, err = convertParam(spec.Type, v); err != nil {
+				return "", nil, fmt.Errorf("query %q: %w %q: %v", q.Tags["name"], ErrInvalidParam, name, err)
+			}
+		}
+		if (!ok && !declared) || (spec.Required && v == nil) {
+			if !missed[name] {
+				missing = append(missing, name)
+				missed[name] = true
+			}
+			continue
+		}
+		if style == NamedBind {
+			v = sql.Named(name, v)
+		}
+		args = append(args, v)
+	}
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("query %q: %w: %s", q.Tags["name"], ErrMissingParam, strings.Join(missing, ", "))
+	}
+
+	if isMap {
+		var unused []string
+		for k := range values {
+			if !used[k] {
+				unused = append(unused, k)
+			}
+		}
+		if len(unused) > 0 {
+			sort.Strings(unused)
+			return "", nil, fmt.Errorf("query %q: %w: %s", q.Tags["name"], ErrUnusedParam, strings.Join(unused, ", "))
+		}
+	}
+	return stmt, args, nil
+}
+
+// lookupKey returns the key of the values for the parameter, an exact match is preferred over a
+// match ignoring the case
+func lookupKey(values map[string]interface{}, name string) (string, bool) {
+	if _, ok := values[name]; ok {
+		return name, true
+	}
+	for k := range values {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// bindValues returns the values of a map or a struct by name, it reports if the values come from a map
+func bindValues(arg interface{}) (map[string]interface{}, bool, error) {
+	values := make(map[string]interface{})
+	if arg == nil {
+		return values, false, nil
+	}
+	if m, ok := arg.(map[string]interface{}); ok {
+		return m, true, nil
+	}
+
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return values, false, nil
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		iter := v.MapRange()
+		for iter.Next() {
+			values[iter.Key().String()] = iter.Value().Interface()
+		}
+		return values, true, nil
+	case v.Kind() == reflect.Struct:
+		structValues(v, values)
+		return values, false, nil
+	}
+	return nil, false, fmt.Errorf("cannot bind parameters from a %T", arg)
+}
+
+// structValues adds the exported fields of a struct to the values, the fields of the embedded
+// structs are added as if they were fields of the struct
+func structValues(v reflect.Value, values map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("db"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if f.Anonymous && tag == "" {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				structValues(fv, values)
+				continue
+			}
+		}
+		if f.PkgPath != "" || !fv.CanInterface() {
+			// unexported field
+			continue
+		}
+
+		name := f.Name
+		if tag != "" {
+			name = tag
+		}
+		if _, ok := values[name]; !ok {
+			values[name] = fv.Interface()
+		}
+	}
+}
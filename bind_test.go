@@ -0,0 +1,189 @@
+package sqlmaper
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebind(t *testing.T) {
+	stmt := "select * from peoples where IdGroup = :IdGroup and Birth::date = :refDate and to_char(Birth, 'HH24:MI') <> :IdGroup"
+	var tests = []struct {
+		style    BindStyle
+		expected string
+	}{
+		{NamedBind, stmt},
+		{QuestionBind, "select * from peoples where IdGroup = ? and Birth::date = ? and to_char(Birth, 'HH24:MI') <> ?"},
+		{DollarBind, "select * from peoples where IdGroup = $1 and Birth::date = $2 and to_char(Birth, 'HH24:MI') <> $3"},
+		{AtBind, "select * from peoples where IdGroup = @p1 and Birth::date = @p2 and to_char(Birth, 'HH24:MI') <> @p3"},
+		{ColonBind, "select * from peoples where IdGroup = :1 and Birth::date = :2 and to_char(Birth, 'HH24:MI') <> :3"},
+	}
+
+	sqlFile := "-- tag:name= Peoples\n" + stmt + ";\n-- tag:name= Dual\nselect 1 from dual;"
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, strings.NewReplacer("'HH24:MI'", "'HH24::MI'", "::date", "::::date").Replace(stmt), queries.Statement("peoples"))
+
+	for i, tt := range tests {
+		sql, names := queries.Query("peoples").Rebind(tt.style)
+		assert.Equal(t, tt.expected, sql, "Case: %d - %s", i, tt.style)
+		assert.Equal(t, []string{"IdGroup", "refDate", "IdGroup"}, names, "Case: %d - %s", i, tt.style)
+	}
+
+	sql, names := queries.Query("dual").Rebind(DollarBind)
+	assert.Equal(t, "select 1 from dual", sql)
+	assert.Nil(t, names)
+}
+
+func TestRebindVerbatim(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+select *
+  from peoples -- :ignored
+ where ID = :ID;
+`
+	queries, err := ParseOptions{Verbatim: true}.ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	sql, names := queries.Query("peoples").Rebind(QuestionBind)
+	assert.Equal(t, "select *\n  from peoples -- :ignored\n where ID = ?", sql)
+	assert.Equal(t, []string{"ID"}, names)
+}
+
+func TestDriverBindStyle(t *testing.T) {
+	var tests = []struct {
+		driver   string
+		expected BindStyle
+		ok       bool
+	}{
+		{"postgres", DollarBind, true},
+		{"pgx", DollarBind, true},
+		{"mysql", QuestionBind, true},
+		{"sqlite3", QuestionBind, true},
+		{"sqlserver", AtBind, true},
+		{"godror", ColonBind, true},
+		{"MySQL", QuestionBind, true},
+		{"unknown", NamedBind, false},
+	}
+
+	for i, tt := range tests {
+		style, ok := DriverBindStyle(tt.driver)
+		assert.Equal(t, tt.expected, style, "Case: %d", i)
+		assert.Equal(t, tt.ok, ok, "Case: %d", i)
+	}
+	assert.Equal(t, "AtBind", AtBind.String())
+	assert.Equal(t, "BindStyle(9)", BindStyle(9).String())
+}
+
+type bindAudit struct {
+	User string `db:"user"`
+}
+
+type bindPeople struct {
+	bindAudit
+	ID      int    `db:"ID"`
+	IdGroup int    `db:"idGroup"`
+	Name    string `db:"name,omitempty"`
+	Secret  string `db:"-"`
+	Nick    string
+	hidden  string
+}
+
+func TestBind(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+select * from peoples where IdGroup = :IdGroup and (Name = :name or Nick = :Nick) and Updater = :user and Name <> :name;
+-- tag:name= Secret
+select * from peoples where Secret = :Secret;
+-- tag:name= Dual
+select 1 from dual;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	peoples := queries.Query("peoples")
+	expected := "select * from peoples where IdGroup = $1 and (Name = $2 or Nick = $3) and Updater = $4 and Name <> $5"
+
+	p := bindPeople{bindAudit: bindAudit{User: "admin"}, ID: 1, IdGroup: 7, Name: "Leo", Nick: "leo2904", hidden: "x"}
+	stmt, args, err := peoples.Bind(DollarBind, p)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, expected, stmt)
+	assert.Equal(t, []interface{}{7, "Leo", "leo2904", "admin", "Leo"}, args)
+
+	stmt, args, err = peoples.Bind(DollarBind, &p)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, expected, stmt)
+	assert.Equal(t, []interface{}{7, "Leo", "leo2904", "admin", "Leo"}, args)
+
+	m := map[string]interface{}{"idgroup": 7, "name": "Leo", "Nick": "leo2904", "user": "admin"}
+	stmt, args, err = peoples.Bind(QuestionBind, m)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, "select * from peoples where IdGroup = ? and (Name = ? or Nick = ?) and Updater = ? and Name <> ?", stmt)
+	assert.Equal(t, []interface{}{7, "Leo", "leo2904", "admin", "Leo"}, args)
+
+	_, args, err = peoples.Bind(NamedBind, map[string]string{"IdGroup": "7", "name": "Leo", "Nick": "leo2904", "user": "admin"})
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []interface{}{
+		sql.Named("IdGroup", "7"), sql.Named("name", "Leo"), sql.Named("Nick", "leo2904"), sql.Named("user", "admin"), sql.Named("name", "Leo"),
+	}, args)
+
+	_, _, err = peoples.Bind(DollarBind, map[string]interface{}{"IdGroup": 7, "user": "admin"})
+	assert.True(t, errors.Is(err, ErrMissingParam), "ErrMissingParam expected: %v", err)
+	assert.Equal(t, `query "Peoples": missing bind parameter: name, Nick`, err.Error())
+
+	m["Age"], m["city"] = 30, "Barcelona"
+	_, _, err = peoples.Bind(DollarBind, m)
+	assert.True(t, errors.Is(err, ErrUnusedParam), "ErrUnusedParam expected: %v", err)
+	assert.Equal(t, `query "Peoples": unused bind parameter: Age, city`, err.Error())
+
+	_, _, err = queries.Query("secret").Bind(DollarBind, p)
+	assert.True(t, errors.Is(err, ErrMissingParam), "ErrMissingParam expected: %v", err)
+
+	stmt, args, err = queries.Query("dual").Bind(DollarBind, nil)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, "select 1 from dual", stmt)
+	assert.Equal(t, []interface{}{}, args)
+
+	_, _, err = peoples.Bind(DollarBind, 42)
+	assert.Equal(t, `query "Peoples": cannot bind parameters from a int`, err.Error())
+}
+
+func TestBindParamSpecs(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+-- tag:param.refDate= date required
+-- tag:param.IdGroup= int default 1
+-- tag:param.name= string
+select * from peoples where IdGroup = :IdGroup and Birth < :refDate and (:name is null or Name = :name);
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	peoples := queries.Query("peoples")
+	refDate := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	_, args, err := peoples.Bind(QuestionBind, map[string]interface{}{"refDate": "2020-01-31"})
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []interface{}{int64(1), refDate, nil, nil}, args)
+
+	_, args, err = peoples.Bind(QuestionBind, map[string]interface{}{"refDate": refDate, "IdGroup": "7", "name": "Leo"})
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []interface{}{int64(7), refDate, "Leo", "Leo"}, args)
+
+	_, _, err = peoples.Bind(QuestionBind, map[string]interface{}{"IdGroup": 7})
+	assert.True(t, errors.Is(err, ErrMissingParam), "ErrMissingParam expected: %v", err)
+	assert.Equal(t, `query "Peoples": missing bind parameter: refDate`, err.Error())
+
+	_, _, err = peoples.Bind(QuestionBind, map[string]interface{}{"refDate": nil})
+	assert.True(t, errors.Is(err, ErrMissingParam), "ErrMissingParam expected: %v", err)
+
+	_, _, err = peoples.Bind(QuestionBind, map[string]interface{}{"refDate": "yesterday"})
+	assert.True(t, errors.Is(err, ErrInvalidParam), "ErrInvalidParam expected: %v", err)
+	assert.Equal(t, `query "Peoples": invalid bind parameter "refDate": parsing time "yesterday" as "2006-01-02": cannot parse "yesterday" as "2006"`, err.Error())
+}
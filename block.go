@@ -0,0 +1,96 @@
+package sqlmaper
+
+import "strings"
+
+// blocks follows the compound statements (BEGIN ... END) and the CASE ... END expressions
+// of a statement, so the semicolons inside them are not taken as the end of the statement.
+// Postgres functions don't need it, their bodies are dollar quoted strings
+type blocks struct {
+	depth     int
+	begin     bool   // a BEGIN was found, it's a block unless it's the start of a transaction
+	end       bool   // an END was found, it could be an END IF, END LOOP, etc
+	prev      string // previous token in upper case, empty at the start of the statement
+	routine   bool   // the statement defines a routine (procedure, function, trigger or event)
+	selecting bool   // the tokens are in the select list of a query, a BEGIN there is a column
+}
+
+// tokens that could be followed by a BEGIN that starts a block, any token when the statement is already
+// inside a block (except a dot or the select list) and the closing parenthesis of the routine parameters
+var beginAfter = map[string]bool{
+	"AS": true, "IS": true, "ROW": true, "THEN": true, "ELSE": true, "LOOP": true, "DO": true,
+	"BEGIN": true, "TRY": true, ";": true, ":": true,
+}
+
+// words that follow a BEGIN when it starts a transaction instead of a block
+var beginTransaction = map[string]bool{
+	"TRANSACTION": true,
+	"TRAN":        true,
+	"WORK":        true,
+	"DEFERRED":    true,
+	"IMMEDIATE":   true,
+	"EXCLUSIVE":   true,
+	"ISOLATION":   true,
+}
+
+// token updates the blocks with the next token of the statement
+func (b *blocks) token(tok token) {
+	switch tok.Type {
+	case tokSpace, tokLineComment, tokBlockComment:
+		return
+	}
+
+	if tok.Type == tokDelimiter {
+		b.selecting = false
+	}
+
+	var word string
+	if tok.Type == tokWord {
+		word = strings.ToUpper(tok.Text)
+	}
+
+	prev := b.prev
+	b.prev = strings.ToUpper(tok.Text)
+
+	if b.begin {
+		b.begin = false
+		if word != "" && !beginTransaction[word] {
+			b.depth++
+		}
+	}
+
+	if b.end {
+		b.end = false
+		switch word {
+		case "IF", "LOOP", "WHILE", "REPEAT", "FOR":
+			// these ends close statements that were not counted
+			b.depth++
+			return
+		case "CASE", "TRY", "CATCH":
+			return
+		}
+	}
+
+	switch word {
+	case "BEGIN":
+		b.begin = prev != "." && !b.selecting &&
+			(prev == "" || b.depth > 0 || beginAfter[prev] || (prev == ")" && b.routine))
+	case "PROCEDURE", "FUNCTION", "TRIGGER", "EVENT":
+		b.routine = true
+	case "SELECT":
+		b.selecting = true
+	case "FROM", "INTO":
+		b.selecting = false
+	case "CASE":
+		b.depth++
+	case "END":
+		if b.depth > 0 {
+			b.depth--
+			b.end = true
+		}
+	}
+}
+
+// open returns true when the statement is inside a block
+func (b *blocks) open() bool {
+	return b.depth > 0
+}
@@ -0,0 +1,112 @@
+package sqlmaper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openAtDelimiters returns, for every semicolon of the feed, if it's inside a block
+func openAtDelimiters(t *testing.T, feed string) []bool {
+	var (
+		b    blocks
+		open []bool
+	)
+	for _, tok := range lexAll(t, feed) {
+		b.token(tok)
+		if tok.Type == tokDelimiter {
+			open = append(open, b.open())
+		}
+	}
+	return open
+}
+
+func TestBlocks(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected []bool
+	}{
+		{"select 1 from dual;", []bool{false}},
+		{"begin;", []bool{false}},
+		{"BEGIN TRANSACTION;", []bool{false}},
+		{"begin work;", []bool{false}},
+		{"select begin, end from periods;", []bool{false}},
+		{"select case when a = 1 then 'a;' else 'b' end from dual;", []bool{false}},
+		{"begin insert into a values (1); end;", []bool{true, false}},
+		{"create procedure p() begin if x then set y = 1; end if; end;", []bool{true, true, false}},
+		{"begin loop exit; end loop; while x loop null; end loop; end;", []bool{true, true, true, true, false}},
+		{"begin case x when 1 then a(); end case; select case when b then 1 end into y from t; end;", []bool{true, true, true, false}},
+		{"begin try select 1; end try begin catch select 2; end catch;", []bool{true, true, false}},
+		{"begin begin null; end; end;", []bool{true, true, false}},
+		{"begin -- comment\n  null; /* ; */ end;", []bool{true, false}},
+		{"end; end;", []bool{false, false}},
+		{"select t.begin from t; select 2;", []bool{false, false}},
+		{"select 1, begin from t; update t set begin = 1 where x.begin > 0;", []bool{false, false}},
+		{"create trigger tr before insert on t for each row begin set new.a = 1; end;", []bool{true, false}},
+		{"create procedure p() begin if x then begin select begin from t; end; end if; end;", []bool{true, true, true, false}},
+		{"create procedure p as begin if @x = 1 begin select 1; end; lbl: begin select 2; end; end;", []bool{true, true, true, true, false}},
+	}
+
+	for i, tt := range tests {
+		assert.Equal(t, tt.expected, openAtDelimiters(t, tt.feed), tt.feed, "Case: %d", i)
+	}
+}
+
+func TestParseReaderBeginColumn(t *testing.T) {
+	queries, err := ParseReader(strings.NewReader("-- tag:name=a\nselect t.begin from t;\n-- tag:name=b\nselect 2;"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "select t.begin from t", queries.Statement("a"))
+	assert.Equal(t, "select 2", queries.Statement("b"))
+}
+
+func TestParseReaderBlocks(t *testing.T) {
+	sqlFile := `
+-- tag:name= Function1
+create or replace function add_one(i integer) returns integer as $$
+begin
+  return i + 1; -- add one
+end;
+$$ language plpgsql;
+
+-- tag:name= Function2
+CREATE FUNCTION check_people() RETURNS trigger AS $body$
+    BEGIN
+        IF NEW.name IS NULL THEN
+            RAISE EXCEPTION 'name cannot be null; $$';
+        END IF;
+        RETURN NEW;
+    END;
+$body$ LANGUAGE plpgsql;
+
+-- tag:name= Do1
+DO $do$ begin perform add_one(1); end $do$;
+
+-- tag:name= Procedure1
+create procedure add_people(in id int)
+begin
+  insert into peoples (ID) values (id);
+  update counters set qty = qty + 1;
+end;
+
+-- tag:name= Transaction1
+begin transaction;
+
+-- tag:name= Select1
+select case when qty > 1 then 'many' else 'one' end from counters;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, 6, len(queries))
+	assert.Equal(t, "create or replace function add_one(i integer) returns integer as $$\nbegin\n  return i + 1; -- add one\nend;\n$$ language plpgsql", queries.Statement("function1"))
+	assert.Equal(t, "CREATE FUNCTION check_people() RETURNS trigger AS $body$\n    BEGIN\n        IF NEW.name IS NULL THEN\n            RAISE EXCEPTION 'name cannot be null; $$';\n        END IF;\n        RETURN NEW;\n    END;\n$body$ LANGUAGE plpgsql", queries.Statement("function2"))
+	assert.Equal(t, "DO $do$ begin perform add_one(1); end $do$", queries.Statement("do1"))
+	assert.Equal(t, "create procedure add_people(in id int) begin insert into peoples (ID) values (id); update counters set qty = qty + 1; end", queries.Statement("procedure1"))
+	assert.Equal(t, "begin transaction", queries.Statement("transaction1"))
+	assert.Equal(t, "select case when qty > 1 then 'many' else 'one' end from counters", queries.Statement("select1"))
+}
@@ -0,0 +1,234 @@
+package sqlmaper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SubKind is the precise kind of statement inside its query type (eg: CreateTable or CreateIndex for a DDL)
+type SubKind int
+
+const (
+	// UnknownKind - the statement could not be classified
+	UnknownKind SubKind = iota
+	// Select - select, table or show statement (DQL)
+	Select
+	// Values - values (1), (2) (DQL)
+	Values
+	// Explain - explain plan of a statement (DQL)
+	Explain
+	// Insert - insert statement (DML)
+	Insert
+	// Update - update statement (DML)
+	Update
+	// Delete - delete statement (DML)
+	Delete
+	// Merge - merge, replace or upsert statement (DML)
+	Merge
+	// CreateTable - create table (DDL)
+	CreateTable
+	// CreateIndex - create index (DDL)
+	CreateIndex
+	// CreateView - create view or materialized view (DDL)
+	CreateView
+	// CreateSequence - create sequence (DDL)
+	CreateSequence
+	// CreateRoutine - create procedure, function, trigger or package (DDL)
+	CreateRoutine
+	// CreateOther - any other create statement: schema, type, synonym, etc (DDL)
+	CreateOther
+	// Alter - alter statement (DDL)
+	Alter
+	// Drop - drop statement (DDL)
+	Drop
+	// Truncate - truncate statement (DDL)
+	Truncate
+	// Rename - rename statement (DDL)
+	Rename
+	// Comment - comment on statement (DDL)
+	Comment
+	// Grant - grant statement (DCL)
+	Grant
+	// Revoke - revoke statement (DCL)
+	Revoke
+	// StartTransaction - begin, start transaction or set transaction (TCL)
+	StartTransaction
+	// Commit - commit statement (TCL)
+	Commit
+	// Rollback - rollback statement (TCL)
+	Rollback
+	// Savepoint - savepoint or release savepoint (TCL)
+	Savepoint
+	// Call - call, exec or execute a stored procedure (PRC)
+	Call
+	// Block - anonymous block: begin ... end, declare or do (PRC)
+	Block
+)
+
+var subKindNames = []string{
+	"UnknownKind", "Select", "Values", "Explain", "Insert", "Update", "Delete", "Merge",
+	"CreateTable", "CreateIndex", "CreateView", "CreateSequence", "CreateRoutine", "CreateOther",
+	"Alter", "Drop", "Truncate", "Rename", "Comment", "Grant", "Revoke",
+	"StartTransaction", "Commit", "Rollback", "Savepoint", "Call", "Block",
+}
+
+// String satisfy stringer interface
+func (k SubKind) String() string {
+	if k >= 0 && int(k) < len(subKindNames) {
+		return subKindNames[k]
+	}
+	return fmt.Sprintf("SubKind(%d)", int(k))
+}
+
+// statements identified by their first word
+var firstWordKinds = map[string]struct {
+	typ  QueryKind
+	kind SubKind
+}{
+	"SELECT":    {DQL, Select},
+	"TABLE":     {DQL, Select},
+	"SHOW":      {DQL, Select},
+	"DESCRIBE":  {DQL, Select},
+	"DESC":      {DQL, Select},
+	"VALUES":    {DQL, Values},
+	"EXPLAIN":   {DQL, Explain},
+	"INSERT":    {DML, Insert},
+	"UPDATE":    {DML, Update},
+	"DELETE":    {DML, Delete},
+	"MERGE":     {DML, Merge},
+	"REPLACE":   {DML, Merge},
+	"UPSERT":    {DML, Merge},
+	"ALTER":     {DDL, Alter},
+	"DROP":      {DDL, Drop},
+	"TRUNCATE":  {DDL, Truncate},
+	"RENAME":    {DDL, Rename},
+	"COMMENT":   {DDL, Comment},
+	"GRANT":     {DCL, Grant},
+	"REVOKE":    {DCL, Revoke},
+	"START":     {TCL, StartTransaction},
+	"COMMIT":    {TCL, Commit},
+	"ROLLBACK":  {TCL, Rollback},
+	"SAVEPOINT": {TCL, Savepoint},
+	"RELEASE":   {TCL, Savepoint},
+	"CALL":      {PRC, Call},
+	"EXEC":      {PRC, Call},
+	"EXECUTE":   {PRC, Call},
+	"DECLARE":   {PRC, Block},
+	"DO":        {PRC, Block},
+}
+
+// objects of a create statement
+var createKinds = map[string]SubKind{
+	"TABLE":     CreateTable,
+	"INDEX":     CreateIndex,
+	"VIEW":      CreateView,
+	"SEQUENCE":  CreateSequence,
+	"PROCEDURE": CreateRoutine,
+	"FUNCTION":  CreateRoutine,
+	"TRIGGER":   CreateRoutine,
+	"PACKAGE":   CreateRoutine,
+}
+
+// words between the create and the object created (CREATE OR REPLACE GLOBAL TEMPORARY TABLE)
+var createModifiers = map[string]bool{
+	"OR": true, "REPLACE": true, "GLOBAL": true, "LOCAL": true, "TEMPORARY": true, "TEMP": true,
+	"UNIQUE": true, "BITMAP": true, "CLUSTERED": true, "NONCLUSTERED": true, "MATERIALIZED": true,
+	"UNLOGGED": true, "EDITIONABLE": true, "NONEDITIONABLE": true, "FORCE": true, "NOFORCE": true,
+	"RECURSIVE": true, "VOLATILE": true, "ALGORITHM": true, "UNDEFINED": true, "MERGE": true, "TEMPTABLE": true,
+	"DEFINER": true, "CURRENT_USER": true, "SQL": true, "SECURITY": true, "INVOKER": true,
+}
+
+// classify returns the type and the kind of a statement.
+// The leading comments, optimizer hints and parentheses are skipped and the main
+// statement of a WITH clause is the one that gives the type
+func classify(stmt string, backslash bool) (QueryKind, SubKind) {
+	words := leadingWords(stmt, backslash)
+	if len(words) == 0 {
+		return UKN, UnknownKind
+	}
+
+	switch words[0] {
+	case "CREATE":
+		for _, w := range words[1:] {
+			if createModifiers[w] {
+				continue
+			}
+			if kind, ok := createKinds[w]; ok {
+				return DDL, kind
+			}
+			break
+		}
+		return DDL, CreateOther
+
+	case "WITH":
+		return classifyWith(stmt, backslash)
+
+	case "BEGIN":
+		if len(words) == 1 || beginTransaction[words[1]] {
+			return TCL, StartTransaction
+		}
+		return PRC, Block
+
+	case "SET":
+		if len(words) > 1 && words[1] == "TRANSACTION" {
+			return TCL, StartTransaction
+		}
+		return UKN, UnknownKind
+	}
+
+	if k, ok := firstWordKinds[words[0]]; ok {
+		return k.typ, k.kind
+	}
+	return UKN, UnknownKind
+}
+
+// leadingWords returns the first words of the statement in upper case, skipping the comments and the
+// parentheses before the first word and any other token after it
+func leadingWords(stmt string, backslash bool) []string {
+	var words []string
+	lx := newStmtLexer(stmt, backslash)
+	for len(words) < 8 {
+		tok, err := lx.next()
+		if err != nil {
+			break
+		}
+		switch tok.Type {
+		case tokSpace, tokLineComment, tokBlockComment:
+			continue
+		case tokWord:
+			words = append(words, strings.ToUpper(tok.Text))
+			continue
+		case tokEOF:
+		default:
+			if len(words) > 0 || tok.Text == "(" {
+				continue
+			}
+		}
+		break
+	}
+	return words
+}
+
+// classifyWith returns the type and kind of the statement that follows the common table expressions
+func classifyWith(stmt string, backslash bool) (QueryKind, SubKind) {
+	depth := 0
+	lx := newStmtLexer(stmt, backslash)
+	for {
+		tok, err := lx.next()
+		if err != nil || tok.Type == tokEOF {
+			return DQL, Select
+		}
+		switch {
+		case tok.Type == tokPunct && tok.Text == "(":
+			depth++
+		case tok.Type == tokPunct && tok.Text == ")":
+			depth--
+		case tok.Type == tokWord && depth == 0:
+			switch w := strings.ToUpper(tok.Text); w {
+			case "SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "VALUES":
+				k := firstWordKinds[w]
+				return k.typ, k.kind
+			}
+		}
+	}
+}
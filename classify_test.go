@@ -0,0 +1,126 @@
+package sqlmaper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	var tests = []struct {
+		feed string
+		typ  QueryKind
+		kind SubKind
+	}{
+		{"", UKN, UnknownKind},
+		{"select * from dual;", DQL, Select},
+		{"create index KKX1 on KK(ID);", DDL, CreateIndex},
+		{"delete from KK where ID = 1;", DML, Delete},
+		{"drop table", DDL, Drop},
+		{"-- select 1 from dual;", UKN, UnknownKind},
+		{"with aux_agendas as (select test_id from dual) select * from aux_agendas;", DQL, Select},
+		{"select 1", DQL, Select},
+		{"SELECT 1", DQL, Select},
+		{"  (select 1 from a) union (select 2 from b)", DQL, Select},
+		{"/* report */ select 1 from dual", DQL, Select},
+		{"/*+ append */ insert into peoples select * from aux", DML, Insert},
+		{"-- comment\nupdate peoples set a = 1", DML, Update},
+		{"merge into peoples p using aux a on (p.id = a.id) when matched then update set p.a = a.a", DML, Merge},
+		{"MERGE INTO peoples", DML, Merge},
+		{"replace into peoples values (1)", DML, Merge},
+		{"insert into peoples values (1)", DML, Insert},
+		{"values (1), (2)", DQL, Values},
+		{"explain select * from peoples", DQL, Explain},
+		{"with recursive t(n) as (values (1) union all select n+1 from t) insert into nums select n from t", DML, Insert},
+		{"with old as (select id from peoples where age > 100) delete from peoples where id in (select id from old)", DML, Delete},
+		{"WITH a AS (SELECT 1), b AS (SELECT 2) UPDATE c SET x = 1", DML, Update},
+		{"with a as (select 1) select * from a", DQL, Select},
+		{"create table peoples (id int)", DDL, CreateTable},
+		{"create global temporary table peoples (id int)", DDL, CreateTable},
+		{"CREATE UNIQUE INDEX peoX1 ON peoples (id)", DDL, CreateIndex},
+		{"create or replace view peoplesVW as select * from peoples", DDL, CreateView},
+		{"create materialized view peoplesMV as select * from peoples", DDL, CreateView},
+		{"create algorithm=merge view v as select 1", DDL, CreateView},
+		{"create sequence peoSEQ", DDL, CreateSequence},
+		{"create or replace function f() returns int as $$ select 1 $$ language sql", DDL, CreateRoutine},
+		{"create procedure p() begin select 1; end", DDL, CreateRoutine},
+		{"create trigger t1 before insert on peoples", DDL, CreateRoutine},
+		{"create schema sales", DDL, CreateOther},
+		{"alter table peoples add column age int", DDL, Alter},
+		{"drop view peoplesVW", DDL, Drop},
+		{"truncate table peoples", DDL, Truncate},
+		{"rename table a to b", DDL, Rename},
+		{"comment on table peoples is 'all of them'", DDL, Comment},
+		{"grant select on peoples to reader", DCL, Grant},
+		{"revoke select on peoples from reader", DCL, Revoke},
+		{"begin", TCL, StartTransaction},
+		{"begin transaction", TCL, StartTransaction},
+		{"start transaction", TCL, StartTransaction},
+		{"set transaction isolation level serializable", TCL, StartTransaction},
+		{"commit", TCL, Commit},
+		{"rollback to savepoint a", TCL, Rollback},
+		{"savepoint a", TCL, Savepoint},
+		{"call add_people(1)", PRC, Call},
+		{"exec add_people 1", PRC, Call},
+		{"execute add_people(1)", PRC, Call},
+		{"begin add_people(1); end;", PRC, Block},
+		{"declare x int; begin null; end;", PRC, Block},
+		{"do $$ begin perform 1; end $$", PRC, Block},
+		{"set search_path = sales", UKN, UnknownKind},
+		{"lock table peoples", UKN, UnknownKind},
+	}
+
+	for i, tt := range tests {
+		typ, kind := classify(tt.feed, false)
+		assert.Equal(t, tt.typ, typ, tt.feed, "Case: %d", i)
+		assert.Equal(t, tt.kind, kind, tt.feed, "Case: %d", i)
+	}
+}
+
+func TestSubKindString(t *testing.T) {
+	assert.Equal(t, "CreateTable", CreateTable.String())
+	assert.Equal(t, "Block", Block.String())
+	assert.Equal(t, "UnknownKind", UnknownKind.String())
+	assert.Equal(t, "SubKind(99)", SubKind(99).String())
+}
+
+func TestQuerySubKind(t *testing.T) {
+	sqlFile := `
+-- tag:name= CreateTable
+create table countries (ID number, Name varchar2(50));
+-- tag:name= CreateIndex
+create index counX1 on countries (ID);
+-- tag:name= Grant
+grant select on countries to reader;
+-- tag:name= Call
+call refresh_countries();
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+
+	var (
+		types []QueryKind
+		kinds []SubKind
+	)
+	iter := queries.NewFileOrderIterator()
+	for iter.Iterate() {
+		types = append(types, iter.QueryType())
+		kinds = append(kinds, iter.SubKind())
+	}
+	assert.Equal(t, []QueryKind{DDL, DDL, DCL, PRC}, types)
+	assert.Equal(t, []SubKind{CreateTable, CreateIndex, Grant, Call}, kinds)
+	assert.Equal(t, CreateIndex, queries.Query("createindex").SubKind())
+}
+
+var resultClassify QueryKind
+
+func BenchmarkClassify(b *testing.B) {
+	var r QueryKind
+	for i := 0; i < b.N; i++ {
+		r, _ = classify("drop table KK;", false)
+	}
+	resultClassify = r
+}
@@ -0,0 +1,95 @@
+package sqlmaper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies the problems found while parsing a sql file
+type ErrorKind int
+
+const (
+	// ReadFailure - the sql stream could not be read
+	ReadFailure ErrorKind = iota + 1
+	// DuplicatedName - two queries with the same name
+	DuplicatedName
+	// UnterminatedQuery - a statement without terminator at the end of the file or before the next name tag
+	UnterminatedQuery
+	// OrphanTag - a tag before any name tag (or outside a named block in strict mode)
+	OrphanTag
+	// EmptyQuery - a name tag followed by no sql (neither a commented out statement)
+	EmptyQuery
+	// UnnamedQuery - a statement without name tag (only in strict mode)
+	UnnamedQuery
+	// TransactionControl - a commit or rollback statement (only in strict mode)
+	TransactionControl
+	// StatementTooLarge - a statement bigger than ParseOptions.MaxStatementSize
+	StatementTooLarge
+	// InvalidTag - a reserved tag with a wrong value
+	InvalidTag
+	// SharedLine - several statements in the line of a named one (only in strict mode)
+	SharedLine
+	// SchemaViolation - a tag that does not follow ParseOptions.Schema or a required tag that is missing
+	SchemaViolation
+	// SplitTransaction - a query separated by other queries from its transaction (only in strict mode)
+	SplitTransaction
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ReadFailure:        "read failure",
+	DuplicatedName:     "duplicated name",
+	UnterminatedQuery:  "unterminated query",
+	OrphanTag:          "orphan tag",
+	EmptyQuery:         "empty query",
+	UnnamedQuery:       "unnamed query",
+	TransactionControl: "transaction control",
+	StatementTooLarge:  "statement too large",
+	InvalidTag:         "invalid tag",
+	SharedLine:         "shared line",
+	SchemaViolation:    "schema violation",
+	SplitTransaction:   "split transaction",
+}
+
+// String satisfy stringer interface
+func (k ErrorKind) String() string {
+	if s, ok := errorKindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ParseError is a problem found while parsing a sql file
+type ParseError struct {
+	Kind  ErrorKind
+	File  string   // file name, empty when the reader has no name
+	Pos   Position // where the problem was found
+	Query string   // name of the query involved, if any
+	Msg   string
+	Err   error // underlying error, if any
+}
+
+// Error satisfy error interface, the message has the form file:line:column: message
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("%s:%s: %s", e.File, e.Pos, e.Msg)
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList is the list of every problem found in a sql file, it's returned by the parser
+// when ParseOptions.AllErrors is set
+type ErrorList []*ParseError
+
+// Error satisfy error interface, it returns one line per problem
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,239 @@
+package sqlmaper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrors(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected *ParseError
+	}{
+		{"-- tag:name= Test1\nselect 1 from dual;\n-- tag: name= Test1\nselect 2 from dual;",
+			&ParseError{Kind: DuplicatedName, Pos: Position{Line: 3, Column: 1}, Query: "Test1", Msg: `duplicated query name: "test1"`}},
+		{"-- tag:name= Test1\nselect 1 from dual;\n-- tag:name= Test2\n  select 2\n  from dual\n",
+			&ParseError{Kind: UnterminatedQuery, Pos: Position{Line: 4, Column: 3}, Query: "Test2", Msg: `query "Test2" has no terminator`}},
+		{"-- tag:name= Test1\nselect 1 from dual\n-- tag:name= Test2\nselect 2 from dual;",
+			&ParseError{Kind: UnterminatedQuery, Pos: Position{Line: 2, Column: 1}, Query: "Test1", Msg: `query "Test1" has no terminator`}},
+		{"-- tag:fileName= peoples.psv\n-- tag:name= Test1\nselect 1 from dual;",
+			&ParseError{Kind: OrphanTag, Pos: Position{Line: 1, Column: 1}, Msg: `tag "filename" before any name tag`}},
+		{"-- tag:name= Test1\n-- tag:fileName= peoples.psv\n\n-- tag:name= Test2\nselect 2 from dual;",
+			&ParseError{Kind: EmptyQuery, Pos: Position{Line: 1, Column: 1}, Query: "Test1", Msg: `query "Test1" has no statement`}},
+		{"-- tag:name= Test1\nselect 1 from dual;\n  -- tag:name= Test2\n",
+			&ParseError{Kind: EmptyQuery, Pos: Position{Line: 3, Column: 3}, Query: "Test2", Msg: `query "Test2" has no statement`}},
+	}
+
+	for i, tt := range tests {
+		_, err := ParseReader(strings.NewReader(tt.feed))
+		assert.Equal(t, tt.expected, err, "Case: %d", i)
+	}
+}
+
+func TestParseErrorsLenient(t *testing.T) {
+	sqlFile := `
+-- tag:name= Test1
+select 1 from dual;
+-- these tags are ignored
+-- tag:fileName= peoples.psv
+-- tag:name= Commented
+-- select * from Fake;
+-- tag:name= Test2
+select 2 from dual;
+select 3 from dual;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "", queries.TagValue("test1", "filename"))
+}
+
+func TestParseAllErrors(t *testing.T) {
+	sqlFile := `-- tag:hash= 1
+-- tag:name= Test1
+select 1 from dual;
+-- tag:name= Test1
+select 2 from dual;
+-- tag:name= Test2
+-- tag:name= Test3
+select 3 from dual;
+-- tag:name= Test4
+select 4 from dual`
+
+	queries, err := ParseOptions{AllErrors: true}.ParseReader(strings.NewReader(sqlFile))
+	var list ErrorList
+	if !assert.True(t, errors.As(err, &list), "ErrorList expected: %v", err) {
+		return
+	}
+
+	var kinds []ErrorKind
+	for _, e := range list {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []ErrorKind{OrphanTag, DuplicatedName, EmptyQuery, UnterminatedQuery}, kinds)
+	assert.Equal(t, "1:1: tag \"hash\" before any name tag\n4:1: duplicated query name: \"test1\"\n6:1: query \"Test2\" has no statement\n10:1: query \"Test4\" has no terminator", err.Error())
+
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "select 1 from dual", queries.Statement("test1"))
+	assert.Equal(t, "select 3 from dual", queries.Statement("test3"))
+
+	queries, err = ParseOptions{AllErrors: true}.ParseReader(strings.NewReader("-- tag:name= Test1\nselect 1 from dual;"))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 1, len(queries))
+}
+
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestParseReadFailure(t *testing.T) {
+	cause := errors.New("disk on fire")
+	r := failingReader{r: strings.NewReader("-- tag:name= Test1\nselect 1 from dual;\n-- tag:name= Test2\nselect"), err: cause}
+
+	_, err := ParseReader(r)
+	var pe *ParseError
+	if !assert.True(t, errors.As(err, &pe), "ParseError expected: %v", err) {
+		return
+	}
+	assert.Equal(t, ReadFailure, pe.Kind)
+	assert.True(t, errors.Is(err, cause))
+	assert.Equal(t, "4:7: reading sql: disk on fire", err.Error())
+}
+
+func TestParseErrorString(t *testing.T) {
+	err := &ParseError{Kind: EmptyQuery, File: "queries.sql", Pos: Position{Line: 3, Column: 1}, Msg: "query \"a\" has no statement"}
+	assert.Equal(t, `queries.sql:3:1: query "a" has no statement`, err.Error())
+	assert.Equal(t, "empty query", EmptyQuery.String())
+	assert.Equal(t, "ErrorKind(0)", ErrorKind(0).String())
+}
+
+func TestParseStrict(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected *ParseError
+	}{
+		{"-- tag:name= Test1\nselect 1 from dual;\n-- tag:fileName= peoples.psv\n-- tag:name= Test2\nselect 2 from dual;",
+			&ParseError{Kind: OrphanTag, Pos: Position{Line: 3, Column: 1}, Msg: `tag "filename" outside a named block`}},
+		{"-- tag:name= Test1\nselect 1 from dual;\nselect 2 from dual;",
+			&ParseError{Kind: UnnamedQuery, Pos: Position{Line: 3, Column: 1}, Msg: "statement without name tag"}},
+		{"-- tag:name= Test1\nselect 1 from dual;\n  commit;",
+			&ParseError{Kind: TransactionControl, Pos: Position{Line: 3, Column: 3}, Msg: `transaction control statement: "commit"`}},
+		{"-- tag:name= Test1\nselect 1 from dual;\nROLLBACK -- undo\n",
+			&ParseError{Kind: TransactionControl, Pos: Position{Line: 3, Column: 1}, Msg: `transaction control statement: "ROLLBACK"`}},
+		{"-- tag:name= Test1\nselect 1 from dual;\nselect 2 from dual",
+			&ParseError{Kind: UnterminatedQuery, Pos: Position{Line: 3, Column: 1}, Msg: "statement without terminator"}},
+	}
+
+	for i, tt := range tests {
+		_, err := ParseOptions{Strict: true}.ParseReader(strings.NewReader(tt.feed))
+		assert.Equal(t, tt.expected, err, "Case: %d", i)
+
+		_, err = ParseReader(strings.NewReader(tt.feed))
+		assert.Nil(t, err, "lenient mode - Case: %d", i)
+	}
+
+	sqlFile := `
+-- tag:name= Peoples
+-- tag:fileName= peoples.psv
+select PeopleID from Peoples;
+
+-- tag:name= Commented
+-- select * from Fake;
+`
+	queries, err := ParseOptions{Strict: true}.ParseReader(strings.NewReader(sqlFile))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 1, len(queries))
+
+	queries, err = ParseOptions{Strict: true}.ParseFreeFileReader(strings.NewReader("select 1 from dual;\nselect 2 from dual;"))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 2, len(queries))
+
+	_, err = ParseOptions{Strict: true, AllErrors: true}.ParseReader(strings.NewReader("select 1 from dual;\ncommit;\n-- tag:name= Test1\nselect 2 from dual;"))
+	assert.Equal(t, "1:1: statement without name tag\n2:1: transaction control statement: \"commit\"", err.Error())
+}
+
+func TestParseInvalidTags(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected string
+	}{
+		{"-- tag:name= Test1\n-- tag:type= SELECT\nselect 1 from dual;", `2:1: tag "type" with invalid query type "SELECT"`},
+		{"-- tag:name= Test1\n-- tag:concurrent= maybe\nselect 1 from dual;", `2:1: tag "concurrent" with invalid boolean "maybe"`},
+		{"-- tag:name= Test1\n-- tag:delimiter=\nselect 1 from dual;", `2:1: tag "delimiter" without value`},
+	}
+
+	for i, tt := range tests {
+		_, err := ParseReader(strings.NewReader(tt.feed))
+		var pe *ParseError
+		if !assert.True(t, errors.As(err, &pe), "ParseError expected - Case: %d", i) {
+			continue
+		}
+		assert.Equal(t, InvalidTag, pe.Kind, "Case: %d", i)
+		assert.Equal(t, "Test1", pe.Query, "Case: %d", i)
+		assert.Equal(t, tt.expected, err.Error(), "Case: %d", i)
+	}
+}
+
+func TestParseMaxStatementSize(t *testing.T) {
+	sqlFile := fmt.Sprintf(`
+-- tag:name= Select1
+select 1 from dual;
+-- tag:name= Insert1
+insert into peoples values (1, '%s');
+-- tag:name= Insert2
+insert into peoples
+  values (1, 'Leo'), -- a long comment also counts
+         (2, 'Ana');
+-- tag:name= Select2
+select 2 from dual;
+`, strings.Repeat("a", 1000))
+
+	opts := ParseOptions{MaxStatementSize: 50}
+	_, err := opts.ParseReader(strings.NewReader(sqlFile))
+	assert.Equal(t, &ParseError{Kind: StatementTooLarge, Pos: Position{Line: 5, Column: 1}, Query: "Insert1", Msg: "statement bigger than 50 bytes"}, err)
+
+	opts.AllErrors = true
+	queries, err := opts.ParseReader(strings.NewReader(sqlFile))
+	assert.Equal(t, "5:1: statement bigger than 50 bytes\n7:1: statement bigger than 50 bytes", err.Error())
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "select 1 from dual", queries.Statement("select1"))
+	assert.Equal(t, "select 2 from dual", queries.Statement("select2"))
+
+	opts.MaxStatementSize = 2000
+	queries, err = opts.ParseReader(strings.NewReader(sqlFile))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 4, len(queries))
+
+	// the limit is for the statements, not for the tags
+	queries, err = ParseOptions{MaxStatementSize: 20}.ParseReader(strings.NewReader("-- tag:name= Select1\n-- tag:fileName= some_long_file_name.csv\nselect 1;"))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, "some_long_file_name.csv", queries.TagValue("select1", "filename"))
+
+	// a statement too large without terminator does not hide the next query
+	sqlFile = fmt.Sprintf(`-- tag:name= Insert1
+insert into peoples values (1, '%s')
+-- tag:name= Select1
+select 1 from dual;
+-- tag:name= Select2
+select 2 from dual;
+`, strings.Repeat("a", 100))
+	queries, err = ParseOptions{MaxStatementSize: 50, AllErrors: true}.ParseReader(strings.NewReader(sqlFile))
+	assert.Equal(t, "2:1: statement bigger than 50 bytes", err.Error())
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "select 1 from dual", queries.Statement("select1"))
+	assert.Equal(t, "select 2 from dual", queries.Statement("select2"))
+}
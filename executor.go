@@ -0,0 +1,338 @@
+package sqlmaper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Executor runs the queries of a sql file against a database, the DML, DDL and any other non concurrent
+// query run one after the other in the order of the file (the sequential iterator) and then the DQL
+// queries run on a pool of workers (the concurrent iterator).
+// The queries of a transaction (Query.Transaction) run in a database transaction in the order of the file,
+// it's committed after the last one and rolled back on a failure or when a rollback statement ends it
+type Executor struct {
+	DB *sql.DB
+
+	// TxOptions are the options of the transactions, nil means the default ones of the driver
+	TxOptions *sql.TxOptions
+
+	// Workers is the maximum number of concurrent queries running at the same time, zero means
+	// the number of CPUs
+	Workers int
+
+	// Prepare returns the statement and the arguments to run a query, nil means the raw statement
+	// (Query.Raw) without arguments. Query.Bind could be used to give the parameters
+	Prepare func(q *Query) (string, []interface{}, error)
+
+	// Rows handles the rows of a DQL query, it could be called from several goroutines at the
+	// same time. Nil means that the rows are only counted
+	Rows func(ctx context.Context, q *Query, rows *sql.Rows) error
+
+	// ContinueOnError keeps running the queries after a failure, by default the queries that
+	// were not started are skipped
+	ContinueOnError bool
+}
+
+// Result is the outcome of a query run by an Executor
+type Result struct {
+	Name     string // name of the query
+	Type     QueryKind
+	Rows     int64 // rows counted for a DQL query or rows affected by any other one (-1 if unknown)
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+	Skipped  bool // the query was not run because of a previous failure or the context was done
+	// RolledBack reports that the query succeeded but its transaction was rolled back
+	RolledBack bool
+}
+
+// Report is the summary of an execution, the results are in the order of the file
+type Report struct {
+	Results   []Result
+	Duration  time.Duration
+	Succeeded int
+	Failed    int
+	Skipped   int
+	// RolledBack are the queries that succeeded inside a transaction that was rolled back
+	RolledBack int
+}
+
+// String satisfy stringer interface, it returns a line per failed query after the totals
+func (r Report) String() string {
+	var str strings.Builder
+	str.WriteString(fmt.Sprintf("%d queries in %s: %d succeeded, %d failed, %d skipped",
+		len(r.Results), r.Duration, r.Succeeded, r.Failed, r.Skipped))
+	if r.RolledBack > 0 {
+		str.WriteString(fmt.Sprintf(", %d rolled back", r.RolledBack))
+	}
+	for _, res := range r.Results {
+		if res.Err != nil && !res.Skipped {
+			str.WriteString(fmt.Sprintf("\n%s: %v", res.Name, res.Err))
+		}
+	}
+	return str.String()
+}
+
+// Err returns the error of the first failed query in the order of the file, nil if none failed
+func (r Report) Err() error {
+	for _, res := range r.Results {
+		if res.Err != nil && !res.Skipped {
+			return fmt.Errorf("query %q: %w", res.Name, res.Err)
+		}
+	}
+	return nil
+}
+
+// ErrSplitTransaction is returned by Executor.Run when the queries of a transaction are not together
+var ErrSplitTransaction = errors.New("separated by other queries from its transaction")
+
+// execer is what is needed to run a query, it's satisfied by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Run runs the queries and returns the report of the execution, the error is the one of the
+// first failed query (Report.Err) or the error of the context when it's done before the end.
+// No query is run when a transaction is split by other queries (ErrSplitTransaction)
+func (e *Executor) Run(ctx context.Context, queries Queries) (*Report, error) {
+	if split := splitTransactions(queries); len(split) > 0 {
+		q := split[0]
+		return nil, fmt.Errorf("query %q: %w %q", q.Tags["name"], ErrSplitTransaction, q.Transaction())
+	}
+
+	start := time.Now()
+	r := newRunner(queries)
+
+	// the queries of a transaction run in the sequential phase even if they are concurrent
+	var seq, conc []*Query
+	iter := queries.NewFileOrderIterator()
+	for iter.Iterate() {
+		if q := iter.query; q.Concurrent() && q.Transaction() == "" {
+			conc = append(conc, q)
+		} else {
+			seq = append(seq, q)
+		}
+	}
+
+	for i := 0; i < len(seq); {
+		q := seq[i]
+		tx := q.Transaction()
+		if tx == "" {
+			if r.stop(ctx, e.ContinueOnError) {
+				r.skip(q, ctx.Err())
+			} else {
+				r.set(e.run(ctx, e.DB, q))
+			}
+			i++
+			continue
+		}
+		// the queries of a transaction are together in the file, they are never moved ahead of other queries
+		j := i + 1
+		for j < len(seq) && seq[j].Transaction() == tx {
+			j++
+		}
+		e.runTx(ctx, r, seq[i:j])
+		i = j
+	}
+
+	jobs := make(chan *Query)
+	var wg sync.WaitGroup
+	for w := 0; w < e.workers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range jobs {
+				r.set(e.run(ctx, e.DB, q))
+			}
+		}()
+	}
+	for _, q := range conc {
+		if r.stop(ctx, e.ContinueOnError) {
+			r.skip(q, ctx.Err())
+			continue
+		}
+		select {
+		case jobs <- q:
+		case <-ctx.Done():
+			r.skip(q, ctx.Err())
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return r.report(ctx, start)
+}
+
+// workers returns the size of the pool of workers
+func (e *Executor) workers() int {
+	if e.Workers > 0 {
+		return e.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// runTx runs the queries of a transaction, on a failure the transaction is rolled back and
+// the queries after the failed one are skipped. The transactions ended by a rollback statement
+// in the file are always rolled back
+func (e *Executor) runTx(ctx context.Context, r *runner, group []*Query) {
+	if r.stop(ctx, e.ContinueOnError) {
+		for _, q := range group {
+			r.skip(q, ctx.Err())
+		}
+		return
+	}
+
+	tx, err := e.DB.BeginTx(ctx, e.TxOptions)
+	if err != nil {
+		r.set(Result{Name: group[0].Tags["name"], Type: group[0].Type, Rows: -1, Start: time.Now(), Err: fmt.Errorf("begin transaction: %w", err)})
+		for _, q := range group[1:] {
+			r.skip(q, nil)
+		}
+		return
+	}
+
+	results := make([]Result, 0, len(group))
+	failed := false
+	for _, q := range group {
+		if failed = ctx.Err() != nil; failed {
+			break
+		}
+		res := e.run(ctx, tx, q)
+		results = append(results, res)
+		if failed = res.Err != nil; failed {
+			break
+		}
+	}
+	rolledBack := failed || group[0].txRollback
+	if !rolledBack {
+		if err := tx.Commit(); err != nil {
+			rolledBack = true
+			results[len(results)-1].Err = fmt.Errorf("commit transaction: %w", err)
+		}
+	} else if err := tx.Rollback(); err != nil && !failed {
+		results[len(results)-1].Err = fmt.Errorf("rollback transaction: %w", err)
+	}
+
+	for _, res := range results {
+		res.RolledBack = rolledBack && res.Err == nil
+		r.set(res)
+	}
+	for _, q := range group[len(results):] {
+		r.skip(q, ctx.Err())
+	}
+}
+
+// run runs a single query, the DQL ones are queried and the others executed. The concurrent tag
+// only changes when a query runs, not how
+func (e *Executor) run(ctx context.Context, db execer, q *Query) (res Result) {
+	res = Result{Name: q.Tags["name"], Type: q.Type, Rows: -1, Start: time.Now()}
+	defer func() { res.Duration = time.Since(res.Start) }()
+
+	stmt, args := q.Raw(), []interface{}(nil)
+	if e.Prepare != nil {
+		if stmt, args, res.Err = e.Prepare(q); res.Err != nil {
+			return res
+		}
+	}
+
+	if q.Type != DQL {
+		r, err := db.ExecContext(ctx, stmt, args...)
+		if res.Err = err; err == nil {
+			if n, err := r.RowsAffected(); err == nil {
+				res.Rows = n
+			}
+		}
+		return res
+	}
+
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if res.Err = err; err != nil {
+		return res
+	}
+	defer rows.Close()
+	if e.Rows != nil {
+		res.Err = e.Rows(ctx, q, rows)
+	} else {
+		res.Rows = 0
+		for rows.Next() {
+			res.Rows++
+		}
+	}
+	if err := rows.Err(); err != nil && res.Err == nil {
+		res.Err = err
+	}
+	if err := rows.Close(); err != nil && res.Err == nil {
+		res.Err = err
+	}
+	return res
+}
+
+// runner keeps the results of an execution
+type runner struct {
+	mu      sync.Mutex
+	results []Result
+	idx     map[string]int // position of the result of each query
+	failed  bool
+}
+
+// newRunner returns a runner with room for the result of every query in the order of the file
+func newRunner(queries Queries) *runner {
+	r := &runner{results: make([]Result, len(queries)), idx: make(map[string]int, len(queries))}
+	for _, q := range queries {
+		r.idx[q.Tags["name"]] = q.idx
+		r.results[q.idx] = Result{Name: q.Tags["name"], Type: q.Type, Rows: -1, Skipped: true}
+	}
+	return r
+}
+
+// set sets the result of a query that has been run
+func (r *runner) set(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[r.idx[res.Name]] = res
+	if res.Err != nil {
+		r.failed = true
+	}
+}
+
+// stop reports if the queries not started yet must be skipped
+func (r *runner) stop(ctx context.Context, continueOnError bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ctx.Err() != nil || (r.failed && !continueOnError)
+}
+
+// skip sets the result of a query that is not run
+func (r *runner) skip(q *Query, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[r.idx[q.Tags["name"]]] = Result{Name: q.Tags["name"], Type: q.Type, Rows: -1, Err: err, Skipped: true}
+}
+
+// report returns the summary of the execution and its error
+func (r *runner) report(ctx context.Context, start time.Time) (*Report, error) {
+	rep := &Report{Results: r.results, Duration: time.Since(start)}
+	for _, res := range rep.Results {
+		switch {
+		case res.Skipped:
+			rep.Skipped++
+		case res.RolledBack:
+			rep.RolledBack++
+		case res.Err != nil:
+			rep.Failed++
+		default:
+			rep.Succeeded++
+		}
+	}
+	if err := rep.Err(); err != nil {
+		return rep, err
+	}
+	return rep, ctx.Err()
+}
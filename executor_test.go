@@ -0,0 +1,443 @@
+package sqlmaper
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDB is a database/sql driver that logs the statements, the ones with the word fail fail
+type fakeDB struct {
+	mu         sync.Mutex
+	log        []string
+	delay      time.Duration // time spent by every query
+	running    int32
+	maxRunning int32
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return d }
+func (d *fakeDB) Open(string) (driver.Conn, error)             { return &fakeConn{db: d}, nil }
+
+func (d *fakeDB) record(stmt string, args []driver.Value) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(args) > 0 {
+		stmt = fmt.Sprintf("%s %v", stmt, args)
+	}
+	d.log = append(d.log, stmt)
+	if strings.Contains(stmt, "fail") {
+		return errors.New("forced failure")
+	}
+	return nil
+}
+
+func (d *fakeDB) statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.log...)
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{db: c.db}, c.db.record("BEGIN", nil)
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (t *fakeTx) Commit() error   { return t.db.record("COMMIT", nil) }
+func (t *fakeTx) Rollback() error { return t.db.record("ROLLBACK", nil) }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.db.record(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	n := atomic.AddInt32(&s.db.running, 1)
+	defer atomic.AddInt32(&s.db.running, -1)
+	for {
+		max := atomic.LoadInt32(&s.db.maxRunning)
+		if n <= max || atomic.CompareAndSwapInt32(&s.db.maxRunning, max, n) {
+			break
+		}
+	}
+	time.Sleep(s.db.delay)
+	if err := s.db.record(s.query, args); err != nil {
+		return nil, err
+	}
+	return &fakeRows{n: 3}, nil
+}
+
+type fakeRows struct{ i, n int }
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= r.n {
+		return io.EOF
+	}
+	r.i++
+	dest[0] = int64(r.i)
+	return nil
+}
+
+const executorFile = `
+-- tag:name= Select1
+select * from peoples;
+-- tag:name= CreateTable
+create table countries (ID number, Name varchar2(50));
+-- tag:name= Select2
+select * from cities;
+-- tag:name= Insert1
+insert into countries (ID, Name) values (1, 'Spain');
+-- tag:name= Select3
+select * from countries;
+-- tag:name= Update1
+update peoples set Name = 'Leo' where ID = 1;
+-- tag:name= Select4
+select * from groups;
+`
+
+func TestExecutor(t *testing.T) {
+	queries, err := ParseReader(strings.NewReader(executorFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{delay: 20 * time.Millisecond}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	exec := &Executor{DB: db, Workers: 2}
+	rep, err := exec.Run(context.Background(), queries)
+	assert.Nil(t, err, "error not expected: %v", err)
+
+	log := fake.statements()
+	if !assert.Equal(t, 7, len(log)) {
+		return
+	}
+	assert.Equal(t, []string{
+		"create table countries (ID number, Name varchar2(50))",
+		"insert into countries (ID, Name) values (1, 'Spain')",
+		"update peoples set Name = 'Leo' where ID = 1",
+	}, log[:3])
+	dql := log[3:]
+	sort.Strings(dql)
+	assert.Equal(t, []string{"select * from cities", "select * from countries", "select * from groups", "select * from peoples"}, dql)
+	assert.True(t, atomic.LoadInt32(&fake.maxRunning) <= 2, "max running: %d", fake.maxRunning)
+
+	var names []string
+	var rows []int64
+	for _, res := range rep.Results {
+		names = append(names, res.Name)
+		rows = append(rows, res.Rows)
+		assert.Nil(t, res.Err)
+		assert.False(t, res.Skipped)
+	}
+	assert.Equal(t, []string{"Select1", "CreateTable", "Select2", "Insert1", "Select3", "Update1", "Select4"}, names)
+	assert.Equal(t, []int64{3, 1, 3, 1, 3, 1, 3}, rows)
+	assert.Equal(t, DDL, rep.Results[1].Type)
+	assert.True(t, rep.Results[0].Duration >= fake.delay)
+	assert.Equal(t, 7, rep.Succeeded)
+	assert.True(t, strings.HasPrefix(rep.String(), "7 queries in "))
+	assert.True(t, strings.HasSuffix(rep.String(), ": 7 succeeded, 0 failed, 0 skipped"))
+}
+
+func TestExecutorErrors(t *testing.T) {
+	sqlFile := strings.Replace(executorFile, "insert into countries", "insert into fail_countries", 1)
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	rep, err := (&Executor{DB: db}).Run(context.Background(), queries)
+	assert.Equal(t, `query "Insert1": forced failure`, err.Error())
+	assert.Equal(t, 2, len(fake.statements()))
+	assert.Equal(t, 1, rep.Succeeded)
+	assert.Equal(t, 1, rep.Failed)
+	assert.Equal(t, 5, rep.Skipped)
+	assert.True(t, rep.Results[0].Skipped)
+	assert.True(t, strings.HasSuffix(rep.String(), ": 1 succeeded, 1 failed, 5 skipped\nInsert1: forced failure"), rep.String())
+
+	fake = &fakeDB{}
+	db = sql.OpenDB(fake)
+	defer db.Close()
+	rep, err = (&Executor{DB: db, ContinueOnError: true}).Run(context.Background(), queries)
+	assert.Equal(t, `query "Insert1": forced failure`, err.Error())
+	assert.Equal(t, 7, len(fake.statements()))
+	assert.Equal(t, 6, rep.Succeeded)
+	assert.Equal(t, 1, rep.Failed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake = &fakeDB{}
+	db = sql.OpenDB(fake)
+	defer db.Close()
+	rep, err = (&Executor{DB: db}).Run(ctx, queries)
+	assert.True(t, errors.Is(err, context.Canceled), "context.Canceled expected: %v", err)
+	assert.Equal(t, 0, len(fake.statements()))
+	assert.Equal(t, 7, rep.Skipped)
+	assert.True(t, errors.Is(rep.Results[0].Err, context.Canceled))
+}
+
+func TestExecutorPrepareAndRows(t *testing.T) {
+	sqlFile := `
+-- tag:name= Update1
+update peoples set Name = :name where ID = :ID;
+-- tag:name= Select1
+select * from peoples where ID = :ID;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	var (
+		mu   sync.Mutex
+		read []int64
+	)
+	exec := &Executor{
+		DB: db,
+		Prepare: func(q *Query) (string, []interface{}, error) {
+			return q.Bind(DollarBind, map[string]interface{}{"ID": 1, "name": "Leo"})
+		},
+		Rows: func(ctx context.Context, q *Query, rows *sql.Rows) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for rows.Next() {
+				var n int64
+				if err := rows.Scan(&n); err != nil {
+					return err
+				}
+				read = append(read, n)
+			}
+			return nil
+		},
+	}
+	_, err = exec.Run(context.Background(), queries)
+	assert.True(t, errors.Is(err, ErrUnusedParam), "ErrUnusedParam expected: %v", err)
+
+	exec.Prepare = func(q *Query) (string, []interface{}, error) {
+		return q.Bind(DollarBind, struct {
+			ID   int
+			Name string
+		}{1, "Leo"})
+	}
+	rep, err := exec.Run(context.Background(), queries)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []string{
+		"update peoples set Name = $1 where ID = $2 [Leo 1]",
+		"select * from peoples where ID = $1 [1]",
+	}, fake.statements()[1:])
+	assert.Equal(t, []int64{1, 2, 3}, read)
+	assert.Equal(t, int64(-1), rep.Results[1].Rows)
+}
+
+func TestExecutorConcurrentTag(t *testing.T) {
+	sqlFile := `
+-- tag:name= Select1
+-- tag:concurrent= false
+select * from peoples;
+-- tag:name= Update1
+-- tag:concurrent= true
+update peoples set Name = 'Leo';
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	// the tag changes when the queries run, the select is still queried and the update executed
+	var handled []string
+	rep, err := (&Executor{DB: db, Rows: func(ctx context.Context, q *Query, rows *sql.Rows) error {
+		handled = append(handled, q.Tags["name"])
+		return nil
+	}}).Run(context.Background(), queries)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []string{"select * from peoples", "update peoples set Name = 'Leo'"}, fake.statements())
+	assert.Equal(t, []string{"Select1"}, handled)
+	assert.Equal(t, int64(1), rep.Results[1].Rows)
+}
+
+func TestExecutorTransactions(t *testing.T) {
+	sqlFile := `
+-- tag:name= Countries
+insert into countries values (1);
+-- tag:name= Cities
+insert into cities values (1);
+commit;
+-- tag:name= Report
+-- tag:tx= load
+select * from cities;
+-- tag:name= Peoples
+-- tag:tx= load
+insert into peoples values (1);
+-- tag:name= Total
+select count(*) from peoples;
+-- tag:name= Clean
+delete from logs;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	rep, err := (&Executor{DB: db, Workers: 1}).Run(context.Background(), queries)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []string{
+		"BEGIN", "insert into countries values (1)", "insert into cities values (1)", "COMMIT",
+		"BEGIN", "select * from cities", "insert into peoples values (1)", "COMMIT",
+		"delete from logs",
+		"select count(*) from peoples",
+	}, fake.statements())
+	assert.Equal(t, 6, rep.Succeeded)
+	assert.Equal(t, int64(3), rep.Results[2].Rows)
+
+	failFile := strings.Replace(sqlFile, "insert into peoples", "insert into fail_peoples", 1)
+	if queries, err = ParseReader(strings.NewReader(failFile)); !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake = &fakeDB{}
+	db = sql.OpenDB(fake)
+	defer db.Close()
+	rep, err = (&Executor{DB: db, ContinueOnError: true}).Run(context.Background(), queries)
+	assert.Equal(t, `query "Peoples": forced failure`, err.Error())
+	assert.Equal(t, []string{
+		"BEGIN", "insert into countries values (1)", "insert into cities values (1)", "COMMIT",
+		"BEGIN", "select * from cities", "insert into fail_peoples values (1)", "ROLLBACK",
+		"delete from logs",
+		"select count(*) from peoples",
+	}, fake.statements())
+	assert.True(t, rep.Results[2].RolledBack)
+	assert.Equal(t, 4, rep.Succeeded)
+	assert.Equal(t, 1, rep.Failed)
+	assert.Equal(t, 1, rep.RolledBack)
+	assert.True(t, strings.HasSuffix(rep.String(), ": 4 succeeded, 1 failed, 0 skipped, 1 rolled back\nPeoples: forced failure"), rep.String())
+
+	failFile = strings.Replace(sqlFile, "insert into countries", "insert into fail_countries", 1)
+	if queries, err = ParseReader(strings.NewReader(failFile)); !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake = &fakeDB{}
+	db = sql.OpenDB(fake)
+	defer db.Close()
+	rep, err = (&Executor{DB: db}).Run(context.Background(), queries)
+	assert.Equal(t, `query "Countries": forced failure`, err.Error())
+	assert.Equal(t, []string{"BEGIN", "insert into fail_countries values (1)", "ROLLBACK"}, fake.statements())
+	assert.Equal(t, 1, rep.Failed)
+	assert.Equal(t, 5, rep.Skipped)
+}
+
+func TestExecutorRollbackStatements(t *testing.T) {
+	queries, err := ParseFreeFileReader(strings.NewReader("insert into a values (1);\nrollback;\ninsert into b values (1);\ncommit;\n"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	rep, err := (&Executor{DB: db}).Run(context.Background(), queries)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []string{
+		"BEGIN", "insert into a values (1)", "ROLLBACK",
+		"BEGIN", "insert into b values (1)", "COMMIT",
+	}, fake.statements())
+	assert.True(t, rep.Results[0].RolledBack)
+	assert.False(t, rep.Results[1].RolledBack)
+	assert.Equal(t, 1, rep.Succeeded)
+	assert.Equal(t, 1, rep.RolledBack)
+}
+
+func TestExecutorInterleavedTransaction(t *testing.T) {
+	sqlFile := `
+-- tag:name= InsertA
+-- tag:tx= t1
+insert into a values (1);
+-- tag:name= CreateB
+create table b (id int);
+-- tag:name= InsertB
+-- tag:tx= t1
+insert into b values (1);
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	// the insert into b could not run before the create table, neither after the commit of t1
+	rep, err := (&Executor{DB: db}).Run(context.Background(), queries)
+	assert.True(t, errors.Is(err, ErrSplitTransaction), "ErrSplitTransaction expected: %v", err)
+	assert.Equal(t, `query "InsertB": separated by other queries from its transaction "t1"`, err.Error())
+	assert.Nil(t, rep)
+	assert.Equal(t, 0, len(fake.statements()))
+}
+
+func TestExecutorTaggedAndRollback(t *testing.T) {
+	sqlFile := `
+-- tag:name= InsertA
+-- tag:tx= load
+insert into a values (1);
+-- tag:name= InsertB
+insert into b values (1);
+rollback;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	// the rollback statement only ends the transaction of the untagged query
+	rep, err := (&Executor{DB: db}).Run(context.Background(), queries)
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []string{
+		"BEGIN", "insert into a values (1)", "COMMIT",
+		"BEGIN", "insert into b values (1)", "ROLLBACK",
+	}, fake.statements())
+	assert.Equal(t, 1, rep.Succeeded)
+	assert.Equal(t, 1, rep.RolledBack)
+}
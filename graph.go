@@ -0,0 +1,501 @@
+package sqlmaper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Tables are the tables and views used by a statement, the names are in lowercase and without quotes
+// (a schema prefix is kept, eg: sales.clients)
+type Tables struct {
+	Creates  []string // created by the statement (create table, create view, etc)
+	Modifies []string // changed by the statement (insert, update, delete, alter, drop, create index, etc)
+	Reads    []string // read by the statement (from, join and merge using clauses)
+}
+
+// Tables returns the tables and views that the statement of the query creates, modifies and reads.
+// It's a best effort made from the keywords of the statement, the tables used by the stored
+// procedures and by the dynamic sql are unknown
+func (q Query) Tables() Tables {
+	return statementTables(q.Raw(), q.kind, q.backslash)
+}
+
+// DependencyReason is why a query depends on another one
+type DependencyReason int
+
+const (
+	// ExplicitDependency - the query has a depends tag with the name of the other one
+	ExplicitDependency DependencyReason = iota + 1
+	// ReadAfterWrite - the query reads a table that a previous query creates or modifies
+	ReadAfterWrite
+	// WriteAfterWrite - the query creates or modifies a table that a previous query creates or modifies
+	WriteAfterWrite
+	// WriteAfterRead - the query creates or modifies a table that a previous query reads
+	WriteAfterRead
+	// Barrier - one of the queries could use any table (stored procedures, anonymous blocks, unknown
+	// statements, etc), so it's run after every previous query and before every following one
+	Barrier
+)
+
+var dependencyReasonNames = map[DependencyReason]string{
+	ExplicitDependency: "depends tag",
+	ReadAfterWrite:     "read after write",
+	WriteAfterWrite:    "write after write",
+	WriteAfterRead:     "write after read",
+	Barrier:            "barrier",
+}
+
+// String satisfy stringer interface
+func (r DependencyReason) String() string {
+	if s, ok := dependencyReasonNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("DependencyReason(%d)", int(r))
+}
+
+// Dependency is an ordering constraint between two queries, Query must run after DependsOn
+type Dependency struct {
+	Query     string // name of the query
+	DependsOn string // name of the query that must run before
+	Reason    DependencyReason
+	Table     string // table or view that makes the dependency, empty for the depends tag and the barriers
+}
+
+// Graph is the dependency graph between the queries of a sql file, a query depends on the previous
+// queries that use the same tables (unless both only read them) and on the queries given in its
+// depends tags (-- tag:depends= Name1, Name2)
+type Graph struct {
+	names []string                // names of the queries in the order of the file
+	keys  map[string]int          // position of each query by its lowercase name
+	deps  map[string][]Dependency // dependencies of each query by its lowercase name
+}
+
+// dependsTag is the tag to set the dependencies of a query explicitly
+const dependsTag = "depends"
+
+// Graph returns the dependency graph of the queries, the names in the depends tags must be
+// names of queries (ErrQueryNotFound otherwise)
+func (q Queries) Graph() (*Graph, error) {
+	ordered := make([]*Query, 0, len(q))
+	for _, qry := range q {
+		ordered = append(ordered, qry)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].idx < ordered[j].idx })
+
+	g := &Graph{keys: make(map[string]int, len(q)), deps: make(map[string][]Dependency, len(q))}
+	tables := make([]Tables, len(ordered))
+	for i, qry := range ordered {
+		g.names = append(g.names, qry.Tags["name"])
+		g.keys[strings.ToLower(qry.Tags["name"])] = i
+		tables[i] = qry.Tables()
+	}
+
+	for i, qry := range ordered {
+		name := qry.Tags["name"]
+		seen := make(map[string]bool)
+		add := func(d Dependency) {
+			if key := strings.ToLower(d.DependsOn); !seen[key] && key != strings.ToLower(name) {
+				seen[key] = true
+				g.deps[strings.ToLower(name)] = append(g.deps[strings.ToLower(name)], d)
+			}
+		}
+
+		for _, value := range qry.TagValues(dependsTag) {
+			for _, dep := range strings.Split(value, ",") {
+				if dep = strings.TrimSpace(dep); dep == "" {
+					continue
+				}
+				j, ok := g.keys[strings.ToLower(dep)]
+				if !ok {
+					return nil, fmt.Errorf("query %q: depends tag: %w: %q", name, ErrQueryNotFound, strings.ToLower(dep))
+				}
+				add(Dependency{Query: name, DependsOn: ordered[j].Tags["name"], Reason: ExplicitDependency})
+			}
+		}
+
+		for j := 0; j < i; j++ {
+			if reason, table := tableDependency(ordered[j], tables[j], qry, tables[i]); reason != 0 {
+				add(Dependency{Query: name, DependsOn: ordered[j].Tags["name"], Reason: reason, Table: table})
+			}
+		}
+	}
+	return g, nil
+}
+
+// Queries returns the names of the queries of the graph in the order of the file
+func (g *Graph) Queries() []string {
+	return append([]string(nil), g.names...)
+}
+
+// Dependencies returns the dependencies of every query, in the order of the file
+func (g *Graph) Dependencies() []Dependency {
+	var deps []Dependency
+	for _, name := range g.names {
+		deps = append(deps, g.deps[strings.ToLower(name)]...)
+	}
+	return deps
+}
+
+// DependsOn returns the names of the queries that must run before the given one
+func (g *Graph) DependsOn(name string) []string {
+	var names []string
+	for _, d := range g.deps[strings.ToLower(name)] {
+		names = append(names, d.DependsOn)
+	}
+	return names
+}
+
+// Dependents returns the names of the queries that must run after the given one, in the order of the file
+func (g *Graph) Dependents(name string) []string {
+	var names []string
+	for _, n := range g.names {
+		for _, d := range g.deps[strings.ToLower(n)] {
+			if strings.EqualFold(d.DependsOn, name) {
+				names = append(names, n)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// tableDependency returns why the query b depends on the previous query a, zero if it does not
+func tableDependency(a *Query, ta Tables, b *Query, tb Tables) (DependencyReason, string) {
+	if isBarrier(a) || isBarrier(b) {
+		return Barrier, ""
+	}
+
+	writesA := append(append([]string(nil), ta.Creates...), ta.Modifies...)
+	writesB := append(append([]string(nil), tb.Creates...), tb.Modifies...)
+	if t := common(writesA, tb.Reads); t != "" {
+		return ReadAfterWrite, t
+	}
+	if t := common(writesA, writesB); t != "" {
+		return WriteAfterWrite, t
+	}
+	if t := common(ta.Reads, writesB); t != "" {
+		return WriteAfterRead, t
+	}
+	return 0, ""
+}
+
+// isBarrier reports if the tables used by the query could not be known
+func isBarrier(q *Query) bool {
+	switch q.Type {
+	case DQL, DML, DDL:
+		return false
+	}
+	return true
+}
+
+// common returns the first name of a that is also in b
+func common(a, b []string) string {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return x
+			}
+		}
+	}
+	return ""
+}
+
+// keywords that end a list of tables (from a x, b y where ...)
+var tableListEnd = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+	"OUTER": true, "NATURAL": true, "ON": true, "USING": true, "GROUP": true, "ORDER": true, "HAVING": true,
+	"LIMIT": true, "OFFSET": true, "FETCH": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"MINUS": true, "WINDOW": true, "FOR": true, "SET": true, "VALUES": true, "SELECT": true, "WHEN": true,
+	"RETURNING": true, "CONNECT": true, "START": true, "PARTITION": true, "WITH": true,
+}
+
+// statementTables returns the tables and views used by a statement of the given kind
+func statementTables(stmt string, kind SubKind, backslash bool) Tables {
+	s := newTableScanner(stmt, backslash)
+	var t Tables
+
+	switch kind {
+	case CreateTable, CreateView, CreateSequence, CreateRoutine:
+		if i := s.after(1, "TABLE", "VIEW", "SEQUENCE", "PROCEDURE", "FUNCTION", "TRIGGER", "PACKAGE"); i > 0 {
+			t.Creates = s.names(s.skipIfExists(i), false)
+		}
+	case CreateIndex:
+		if i := s.after(1, "ON"); i > 0 {
+			t.Modifies = s.names(i, false)
+		}
+	case Insert, Merge:
+		if i := s.after(1, "INTO"); i > 0 {
+			t.Modifies = s.names(i, false)
+		}
+		if i := s.after(1, "USING"); kind == Merge && i > 0 {
+			t.Reads = s.names(i, false)
+		}
+	case Update:
+		if i := s.after(0, "UPDATE"); i > 0 {
+			t.Modifies = s.names(s.skip(i, "ONLY"), false)
+		}
+	case Delete:
+		if i := s.after(0, "DELETE"); i > 0 {
+			t.Modifies = s.names(s.skip(s.skip(i, "FROM"), "ONLY"), false)
+		}
+	case Alter, Drop:
+		if i := s.after(0, "TABLE", "VIEW", "INDEX", "SEQUENCE"); i > 0 {
+			t.Modifies = s.names(s.skipIfExists(i), kind == Drop)
+		}
+	case Truncate:
+		if i := s.after(0, "TRUNCATE"); i > 0 {
+			t.Modifies = s.names(s.skip(i, "TABLE"), true)
+		}
+	case Comment:
+		if i := s.after(0, "TABLE", "VIEW"); i > 0 {
+			t.Modifies = s.names(i, false)
+		}
+	case Rename:
+		if i := s.after(0, "RENAME"); i > 0 {
+			i = s.skip(i, "TABLE")
+			t.Modifies = s.names(i, false)
+			if j := s.after(i, "TO"); j > 0 {
+				t.Creates = s.names(j, false)
+			}
+		}
+	}
+
+	t.Reads = unique(append(t.Reads, s.reads(kind)...))
+	return t
+}
+
+// tableScanner finds the table names in the significant tokens of a statement
+type tableScanner struct {
+	toks []token
+	ctes map[string]bool // names of the common table expressions, they are not tables
+}
+
+// newTableScanner returns a scanner for the statement
+func newTableScanner(stmt string, backslash bool) *tableScanner {
+	s := &tableScanner{ctes: make(map[string]bool)}
+	lx := newStmtLexer(stmt, backslash)
+	for {
+		tok, err := lx.next()
+		if (err != nil && err != io.ErrUnexpectedEOF) || tok.Type == tokEOF {
+			// an unclosed identifier could still be a name
+			break
+		}
+		switch tok.Type {
+		case tokSpace, tokLineComment, tokBlockComment, tokDelimiter, tokDirective:
+			continue
+		}
+		s.toks = append(s.toks, tok)
+	}
+
+	// with name [(columns)] as [not] [materialized] (...), name as (...)
+	if s.word(0) == "WITH" {
+		i := s.skip(1, "RECURSIVE")
+		for i < len(s.toks) {
+			name, next := s.name(i)
+			if name == "" {
+				break
+			}
+			s.ctes[name] = true
+			i = next
+			if s.punct(i) == "(" {
+				i = s.close(i)
+			}
+			i = s.skip(s.skip(s.skip(i, "AS"), "NOT"), "MATERIALIZED")
+			if s.punct(i) != "(" {
+				break
+			}
+			i = s.close(i)
+			if s.punct(i) != "," {
+				break
+			}
+			i++
+		}
+	}
+	return s
+}
+
+// word returns the word at i in uppercase, empty if it's not a word
+func (s *tableScanner) word(i int) string {
+	if i < 0 || i >= len(s.toks) || s.toks[i].Type != tokWord {
+		return ""
+	}
+	return strings.ToUpper(s.toks[i].Text)
+}
+
+// punct returns the punctuation at i, empty if it's not a punctuation
+func (s *tableScanner) punct(i int) string {
+	if i < 0 || i >= len(s.toks) || s.toks[i].Type != tokPunct {
+		return ""
+	}
+	return s.toks[i].Text
+}
+
+// skip returns the position after the word at i if it's the given one, i otherwise
+func (s *tableScanner) skip(i int, word string) int {
+	if s.word(i) == word {
+		return i + 1
+	}
+	return i
+}
+
+// skipIfExists skips the if exists and if not exists clauses
+func (s *tableScanner) skipIfExists(i int) int {
+	if s.word(i) == "IF" {
+		return s.skip(s.skip(i+1, "NOT"), "EXISTS")
+	}
+	return i
+}
+
+// after returns the position after the first of the words found from i (outside parentheses), 0 if none is found
+func (s *tableScanner) after(i int, words ...string) int {
+	depth := 0
+	for ; i < len(s.toks); i++ {
+		switch s.punct(i) {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+		w := s.word(i)
+		for _, word := range words {
+			if w == word {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// close returns the position after the parenthesis that closes the one at i
+func (s *tableScanner) close(i int) int {
+	depth := 0
+	for ; i < len(s.toks); i++ {
+		switch s.punct(i) {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// name returns the name (schema.table) at i in lowercase and the position after it
+func (s *tableScanner) name(i int) (string, int) {
+	var parts []string
+	for i < len(s.toks) {
+		tok := s.toks[i]
+		switch tok.Type {
+		case tokWord:
+			parts = append(parts, strings.ToLower(tok.Text))
+		case tokIdent:
+			parts = append(parts, strings.ToLower(unquote(tok.Text)))
+		default:
+			return strings.Join(parts, "."), i
+		}
+		i++
+		if s.punct(i) != "." {
+			break
+		}
+		i++
+	}
+	return strings.Join(parts, "."), i
+}
+
+// unquote returns a quoted identifier without its quotes, the closing one could be missing
+// when the statement ends inside the identifier
+func unquote(ident string) string {
+	quote := ident[:1]
+	ident = ident[1:]
+	if len(ident) > 0 && strings.HasSuffix(ident, quote) {
+		ident = ident[:len(ident)-1]
+	}
+	return ident
+}
+
+// names returns the name at i, or the comma separated names when list is set (drop table a, b)
+func (s *tableScanner) names(i int, list bool) []string {
+	var names []string
+	for {
+		name, next := s.name(i)
+		if name == "" {
+			return names
+		}
+		names = append(names, name)
+		if !list || s.punct(next) != "," {
+			return names
+		}
+		i = next + 1
+	}
+}
+
+// reads returns the tables found after the from and join keywords, the ones inside the parentheses
+// of a function call (extract(year from x)) and the common table expressions are skipped
+func (s *tableScanner) reads(kind SubKind) []string {
+	var (
+		reads []string
+		subq  []bool // the open parentheses, true for the subqueries
+	)
+	for i := 0; i < len(s.toks); i++ {
+		switch s.punct(i) {
+		case "(":
+			w := s.word(i + 1)
+			subq = append(subq, w == "SELECT" || w == "WITH" || w == "VALUES")
+			continue
+		case ")":
+			if len(subq) > 0 {
+				subq = subq[:len(subq)-1]
+			}
+			continue
+		}
+		if len(subq) > 0 && !subq[len(subq)-1] {
+			continue
+		}
+
+		w := s.word(i)
+		if (w != "FROM" && w != "JOIN") || (kind == Delete && s.word(i-1) == "DELETE") {
+			continue
+		}
+		// from a [as] x, b y
+		j := s.skip(s.skip(i+1, "ONLY"), "LATERAL")
+		for {
+			name, next := s.name(j)
+			if name == "" || tableListEnd[strings.ToUpper(name)] {
+				break
+			}
+			if !s.ctes[name] {
+				reads = append(reads, name)
+			}
+			next = s.skip(next, "AS")
+			if a := s.word(next); a != "" && !tableListEnd[a] {
+				next++
+			}
+			if w == "JOIN" || s.punct(next) != "," {
+				break
+			}
+			j = next + 1
+		}
+	}
+	return reads
+}
+
+// unique returns the names without duplicates in their order
+func unique(names []string) []string {
+	var list []string
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			list = append(list, n)
+		}
+	}
+	return list
+}
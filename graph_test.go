@@ -0,0 +1,139 @@
+package sqlmaper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatementTables(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected Tables
+	}{
+		{"select 1 from dual", Tables{Reads: []string{"dual"}}},
+		{"select * from \"", Tables{}},
+		{"select * from \"Groups", Tables{Reads: []string{"groups"}}},
+		{"select * from peoples p, cities c where p.CityID = c.CityID", Tables{Reads: []string{"peoples", "cities"}}},
+		{"select * from peoples as p join sales.cities c on p.CityID = c.CityID left outer join \"Groups\" g using (GroupID)",
+			Tables{Reads: []string{"peoples", "sales.cities", "groups"}}},
+		{"select extract(year from Birth), (select max(ID) from groups) from peoples", Tables{Reads: []string{"groups", "peoples"}}},
+		{"with old as (select id from peoples where age > 100) select * from old join cities on 1 = 1", Tables{Reads: []string{"peoples", "cities"}}},
+		{"select * from (select * from peoples) p", Tables{Reads: []string{"peoples"}}},
+		{"create table TempPersons as select PersonID from Persons where GroupID = :IdGroup", Tables{Creates: []string{"temppersons"}, Reads: []string{"persons"}}},
+		{"create table if not exists countries (ID int)", Tables{Creates: []string{"countries"}}},
+		{"create or replace view SalesVW as select ClientID from Sales", Tables{Creates: []string{"salesvw"}, Reads: []string{"sales"}}},
+		{"create unique index tempperX1 on TempPersons(BirthDate)", Tables{Modifies: []string{"temppersons"}}},
+		{"insert into peoples (ID, Name) select ID, Name from aux", Tables{Modifies: []string{"peoples"}, Reads: []string{"aux"}}},
+		{"update only Stocks set qty = 0 where qty = -1", Tables{Modifies: []string{"stocks"}}},
+		{"update peoples set Age = (select max(Age) from aux)", Tables{Modifies: []string{"peoples"}, Reads: []string{"aux"}}},
+		{"delete from peoples where ID in (select ID from old)", Tables{Modifies: []string{"peoples"}, Reads: []string{"old"}}},
+		{"with old as (select ID from aux) delete from peoples where ID in (select ID from old)", Tables{Modifies: []string{"peoples"}, Reads: []string{"aux"}}},
+		{"merge into peoples p using aux a on (p.ID = a.ID) when matched then update set p.Name = a.Name", Tables{Modifies: []string{"peoples"}, Reads: []string{"aux"}}},
+		{"alter table peoples add column Age int", Tables{Modifies: []string{"peoples"}}},
+		{"drop table if exists peoples, cities", Tables{Modifies: []string{"peoples", "cities"}}},
+		{"drop materialized view peoplesMV", Tables{Modifies: []string{"peoplesmv"}}},
+		{"truncate table peoples", Tables{Modifies: []string{"peoples"}}},
+		{"rename table a to b", Tables{Modifies: []string{"a"}, Creates: []string{"b"}}},
+		{"comment on table peoples is 'all of them'", Tables{Modifies: []string{"peoples"}}},
+		{"grant select on peoples to reader", Tables{}},
+	}
+
+	for i, tt := range tests {
+		_, kind := classify(tt.feed, false)
+		assert.Equal(t, tt.expected, statementTables(tt.feed, kind, false), tt.feed, "Case: %d", i)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	sqlFile := `
+-- tag:name= TempPersons
+create table TempPersons as
+select PersonID, BirthDate, Gender from Persons where GroupID = :IdGroup;
+
+-- tag:name= ExportPersons
+select PersonID, BirthDate, Gender from Persons where BirthDate <= :refDate;
+
+-- tag:name= ExportCities
+select CityID, Name, ProvID from cities;
+
+-- tag:name= TempPersonsIndex
+create index tempperX1 on TempPersons(BirthDate);
+
+-- tag:name= UpdateStocks
+update Stocks set qty = 0 where qty = -1;
+
+-- tag:name= SalesVW
+create view SalesVW as
+select ClientID, Qty, Amount from Sales where CompanyID = 1;
+
+-- tag:name= Sales
+select ClientID, Qty, Amount from SalesVW;
+
+-- tag:name= Report
+-- tag:depends= ExportCities, exportpersons
+-- tag:depends= UpdateStocks
+select count(*) from Stocks;
+
+-- tag:name= ResetPersons
+update Persons set GroupID = 0;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	g, err := queries.Graph()
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+
+	assert.Equal(t, []string{"TempPersons", "ExportPersons", "ExportCities", "TempPersonsIndex", "UpdateStocks", "SalesVW", "Sales", "Report", "ResetPersons"}, g.Queries())
+	assert.Equal(t, []Dependency{
+		{Query: "TempPersonsIndex", DependsOn: "TempPersons", Reason: WriteAfterWrite, Table: "temppersons"},
+		{Query: "Sales", DependsOn: "SalesVW", Reason: ReadAfterWrite, Table: "salesvw"},
+		{Query: "Report", DependsOn: "ExportCities", Reason: ExplicitDependency},
+		{Query: "Report", DependsOn: "ExportPersons", Reason: ExplicitDependency},
+		{Query: "Report", DependsOn: "UpdateStocks", Reason: ExplicitDependency},
+		{Query: "ResetPersons", DependsOn: "TempPersons", Reason: WriteAfterRead, Table: "persons"},
+		{Query: "ResetPersons", DependsOn: "ExportPersons", Reason: WriteAfterRead, Table: "persons"},
+	}, g.Dependencies())
+
+	assert.Equal(t, []string{"SalesVW"}, g.DependsOn("SALES"))
+	assert.Nil(t, g.DependsOn("ExportCities"))
+	assert.Equal(t, []string{"Report", "ResetPersons"}, g.Dependents("exportpersons"))
+	assert.Equal(t, "read after write", ReadAfterWrite.String())
+	assert.Equal(t, "DependencyReason(0)", DependencyReason(0).String())
+}
+
+func TestGraphBarriers(t *testing.T) {
+	sqlFile := `
+-- tag:name= Select1
+select * from peoples;
+-- tag:name= Refresh
+call refresh_all();
+-- tag:name= Select2
+select * from cities;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	g, err := queries.Graph()
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, []Dependency{
+		{Query: "Refresh", DependsOn: "Select1", Reason: Barrier},
+		{Query: "Select2", DependsOn: "Refresh", Reason: Barrier},
+	}, g.Dependencies())
+
+	queries, err = ParseReader(strings.NewReader("-- tag:name= Select1\n-- tag:depends= Missing\nselect 1 from dual;"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	_, err = queries.Graph()
+	assert.True(t, errors.Is(err, ErrQueryNotFound), "ErrQueryNotFound expected: %v", err)
+	assert.Equal(t, `query "Select1": depends tag: query not found: "missing"`, err.Error())
+}
@@ -55,10 +55,25 @@ func (i *Iterator) Statement() string {
 }
 
 // QueryType returns the type of the query fetched in the last iteration
-func (i *Iterator) QueryType() int {
+func (i *Iterator) QueryType() QueryKind {
 	return i.query.QueryType()
 }
 
+// TagValues returns every value of a tag of the query fetched in the last iteration
+func (i *Iterator) TagValues(tag string) []string {
+	return i.query.TagValues(tag)
+}
+
+// SubKind returns the precise kind of statement of the query fetched in the last iteration
+func (i *Iterator) SubKind() SubKind {
+	return i.query.SubKind()
+}
+
+// Source returns the place of the sql file where the query fetched in the last iteration was found
+func (i *Iterator) Source() Source {
+	return i.query.Source()
+}
+
 // TagValue returns the tag value of the tags asociated with the query fetched in the last iteration
 func (i *Iterator) TagValue(tag string) string {
 	return i.query.TagValue(tag)
@@ -73,30 +88,24 @@ func initFileOrderIterator(q Queries) []string {
 }
 
 func initSequentialIterator(q Queries) []string {
-	// In this case where are interested in all type of statements except selects
+	// In this case where are interested in all type of statements except the concurrent ones
 	return initIterator(q, false)
 }
 
 // initConcurrentIterator returns a slice of query names in the order to be procesed
 // in this particular case the order souldn't be necessary but it is to easy the testing
 func initConcurrentIterator(q Queries) []string {
-	// In this case we are only interested in select statements because these are
-	// the only type of statements that could be executed in concurrent way
+	// In this case we are only interested in select statements (or the ones tagged as concurrent)
+	// because these are the only type of statements that could be executed in concurrent way
 	return initIterator(q, true)
 }
 
-func initIterator(q Queries, dql bool) []string {
+func initIterator(q Queries, concurrent bool) []string {
 	foi := make([]string, len(q))
 	cant := 0
 	for k, v := range q {
-		if dql {
-			if v.Type != DQL {
-				continue
-			}
-		} else {
-			if v.Type == DQL {
-				continue
-			}
+		if v.Concurrent() != concurrent {
+			continue
 		}
 		foi[v.idx] = k
 		cant++
@@ -218,3 +218,39 @@ create table countries (ID number, Name varchar2(50));
 		assert.Nil(t, seqIter.queries, "should be not queries in concurrent iterator")
 	}
 }
+
+func TestConcurrentIteratorOverrides(t *testing.T) {
+	sqlFile := `
+-- tag:name= Select1
+select * from peoples;
+-- tag:name= Purge
+-- tag:type= DML
+with old as (select id from peoples where age > 100) select purge_peoples(id) from old;
+-- tag:name= Locked
+-- tag:concurrent= false
+select * from cities for update;
+-- tag:name= Refresh
+-- tag:type= dml
+-- tag:concurrent= true
+refresh materialized view peoplesMV;
+`
+
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, DML, queries.QueryType("purge"))
+	assert.Equal(t, DQL, queries.QueryType("locked"))
+	assert.Equal(t, DML, queries.QueryType("refresh"))
+
+	seqIter, concIter := queries.NewConcurrentIterators()
+	var seq, conc []string
+	for seqIter.Iterate() {
+		seq = append(seq, seqIter.TagValue("name"))
+	}
+	for concIter.Iterate() {
+		conc = append(conc, concIter.TagValue("name"))
+	}
+	assert.Equal(t, []string{"Purge", "Locked"}, seq)
+	assert.Equal(t, []string{"Select1", "Refresh"}, conc)
+}
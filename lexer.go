@@ -0,0 +1,364 @@
+package sqlmaper
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokens recognized by the lexer
+const (
+	tokEOF          = iota
+	tokSpace        // blanks, tabs and new lines
+	tokWord         // keywords, identifiers and numbers
+	tokPunct        // any other single character (operators, parentheses, colons, etc)
+	tokString       // 'string literal' or $tag$ dollar quoted string $tag$
+	tokIdent        // "quoted identifier" or `quoted identifier`
+	tokLineComment  // -- comment until the end of the line
+	tokBlockComment // /* comment */ (could span several lines and be nested)
+	tokDelimiter    // statement terminator (the current delimiter or a line with only / or GO)
+	tokDirective    // a DELIMITER line that changes the statement terminator
+)
+
+// maxDirectiveLine is the longest line that could be checked as a directive
+const maxDirectiveLine = 256
+
+type token struct {
+	Type int
+	Text string
+	Line int
+	Col  int
+}
+
+// lexer splits a sql stream into tokens.
+// It's a streaming lexer, it never holds more than the token being read, so
+// the statement boundaries are decided by the parser looking at the delimiter tokens
+// and there is no limit in the length of the lines
+type lexer struct {
+	r     *bufio.Reader
+	delim string // statement terminator, empty when the statements are only terminated by a / or GO line
+	limit int    // maximum length of the token text, the rest is consumed but discarded (0 is no limit). The line comments are never cut, they could be tags
+	line  int    // line of the next rune
+	col   int    // column of the next rune
+	buf   strings.Builder
+
+	// backslash makes \ an escape character inside the single and double quoted texts (MySQL 'it\'s')
+	backslash bool
+}
+
+func newLexer(r io.Reader) *lexer {
+	return &lexer{
+		r:     bufio.NewReader(r),
+		delim: ";",
+		line:  1,
+		col:   1,
+	}
+}
+
+// newStmtLexer returns a lexer for a statement already parsed, backslash is the ParseOptions.BackslashEscapes
+// used to parse it
+func newStmtLexer(stmt string, backslash bool) *lexer {
+	lx := newLexer(strings.NewReader(stmt))
+	lx.backslash = backslash
+	return lx
+}
+
+// next returns the next token of the stream, at the end of the stream it returns a tokEOF token.
+// A literal, quoted identifier or comment cut by the end of the stream is returned with io.ErrUnexpectedEOF
+func (l *lexer) next() (token, error) {
+	l.buf.Reset()
+	tok := token{Line: l.line, Col: l.col}
+
+	if l.col == 1 {
+		if typ, n := l.directive(); n > 0 {
+			err := l.skip(n)
+			tok.Type = typ
+			tok.Text = l.buf.String()
+			return tok, err
+		}
+	}
+
+	if l.delim != "" && l.peek(len(l.delim)) == l.delim {
+		if err := l.skip(len(l.delim)); err != nil {
+			return tok, err
+		}
+		tok.Type = tokDelimiter
+		tok.Text = l.buf.String()
+		return tok, nil
+	}
+
+	c, err := l.read()
+	if err == io.EOF {
+		tok.Type = tokEOF
+		return tok, nil
+	}
+	if err != nil {
+		return tok, err
+	}
+
+	switch {
+	case unicode.IsSpace(c):
+		// a space token never goes beyond the end of the line, so every line starts with a new token
+		tok.Type = tokSpace
+		if c != '\n' {
+			err = l.readWhile(func(r rune) bool { return r != '\n' && unicode.IsSpace(r) })
+			if err == nil && l.peek(1) == "\n" {
+				_, err = l.read()
+			}
+		}
+
+	case c == '-' && l.peek(1) == "-":
+		tok.Type = tokLineComment
+		limit := l.limit
+		l.limit = 0
+		err = l.readWhile(func(r rune) bool { return r != '\n' })
+		l.limit = limit
+
+	case c == '/' && l.peek(1) == "*":
+		tok.Type = tokBlockComment
+		err = unclosed(l.readBlockComment())
+
+	case c == '\'':
+		tok.Type = tokString
+		err = unclosed(l.readQuoted('\'', l.backslash))
+
+	case (c == 'e' || c == 'E') && l.peek(1) == "'":
+		// postgres escape string constant (E'it\'s'), the backslash is always an escape character
+		tok.Type = tokString
+		if _, err = l.read(); err == nil {
+			err = unclosed(l.readQuoted('\'', true))
+		}
+
+	case c == '$' && l.dollarTag() != "":
+		// postgres dollar quoted string ($$ body $$ or $tag$ body $tag$)
+		tok.Type = tokString
+		err = unclosed(l.readDollarQuoted())
+
+	case c == '"' || c == '`':
+		tok.Type = tokIdent
+		err = unclosed(l.readQuoted(c, c == '"' && l.backslash))
+
+	case isWordRune(c):
+		// the delimiter could be made of word characters (END$$)
+		tok.Type = tokWord
+		err = l.readWhile(func(r rune) bool { return isWordRune(r) && !l.atDelimiter(r) })
+
+	default:
+		tok.Type = tokPunct
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+	tok.Text = l.buf.String()
+	return tok, err
+}
+
+// unclosed returns io.ErrUnexpectedEOF when the stream ends inside a literal, a quoted identifier or a
+// comment. The lexer returns it along with the token read so far
+func unclosed(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// directive checks if the line that starts in the next rune is a directive and returns
+// its token type and its length (not including the new line)
+// A line with only a / (Oracle) or a GO (SQL Server) is a statement terminator and a line
+// like DELIMITER // (MySQL) changes the delimiter
+func (l *lexer) directive() (int, int) {
+	line := l.peek(maxDirectiveLine)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	} else if len(line) == maxDirectiveLine {
+		return 0, 0
+	}
+
+	cmd := strings.TrimSpace(line)
+	if cmd == "/" || strings.EqualFold(cmd, "GO") {
+		return tokDelimiter, len(strings.TrimRight(line, "\r"))
+	}
+	if _, ok := delimiterDirective(cmd); ok {
+		return tokDirective, len(strings.TrimRight(line, "\r"))
+	}
+	return 0, 0
+}
+
+// delimiterDirective returns the new delimiter of a DELIMITER line
+func delimiterDirective(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "DELIMITER") {
+		return "", false
+	}
+	return inlineDelimiter(fields[1]), true
+}
+
+// inlineDelimiter returns the delimiter that the lexer should look for inside the lines,
+// / and GO are only valid as a whole line so there is no inline delimiter for them
+func inlineDelimiter(delim string) string {
+	if delim == "/" || strings.EqualFold(delim, "GO") {
+		return ""
+	}
+	return delim
+}
+
+// atDelimiter returns true when the next rune, r, is the start of the delimiter
+func (l *lexer) atDelimiter(r rune) bool {
+	if l.delim == "" {
+		return false
+	}
+	first, _ := utf8.DecodeRuneInString(l.delim)
+	return r == first && l.peek(len(l.delim)) == l.delim
+}
+
+// read consumes the next rune adding it to the current token
+func (l *lexer) read() (rune, error) {
+	c, _, err := l.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if l.limit == 0 || l.buf.Len() < l.limit {
+		l.buf.WriteRune(c)
+	}
+	if c == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return c, nil
+}
+
+// skip consumes n bytes
+func (l *lexer) skip(n int) error {
+	for n > 0 {
+		c, err := l.read()
+		if err != nil {
+			return err
+		}
+		n -= utf8.RuneLen(c)
+	}
+	return nil
+}
+
+// peek returns the next n bytes without consuming them, it could return less bytes at the end of the stream
+func (l *lexer) peek(n int) string {
+	b, _ := l.r.Peek(n)
+	return string(b)
+}
+
+// peekRune returns the next rune without consuming it
+func (l *lexer) peekRune() (rune, error) {
+	c, _, err := l.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	return c, l.r.UnreadRune()
+}
+
+// readWhile consumes runes while they satisfy f
+func (l *lexer) readWhile(f func(rune) bool) error {
+	for {
+		c, err := l.peekRune()
+		if err != nil {
+			return err
+		}
+		if !f(c) {
+			return nil
+		}
+		if _, err := l.read(); err != nil {
+			return err
+		}
+	}
+}
+
+// readQuoted consumes a quoted text until the closing quote, the opening quote has already been read.
+// A doubled quote is an escaped quote and when backslash is true, \ escapes the next rune
+func (l *lexer) readQuoted(quote rune, backslash bool) error {
+	for {
+		c, err := l.read()
+		if err != nil {
+			return err
+		}
+		switch {
+		case backslash && c == '\\':
+			if _, err := l.read(); err != nil {
+				return err
+			}
+		case c == quote:
+			if l.peek(1) != string(quote) {
+				return nil
+			}
+			if _, err := l.read(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dollarTag returns the rest of the opening mark of a dollar quoted string ("$" or "tag$")
+// when the next runes are one, the first $ has already been read
+func (l *lexer) dollarTag() string {
+	next := l.peek(maxDirectiveLine)
+	for i, r := range next {
+		switch {
+		case r == '$':
+			return next[:i+1]
+		case r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)):
+			continue
+		}
+		return ""
+	}
+	return ""
+}
+
+// readDollarQuoted consumes a dollar quoted string until the closing mark, the first $ has already been read
+func (l *lexer) readDollarQuoted() error {
+	tag := l.dollarTag()
+	if err := l.skip(len(tag)); err != nil {
+		return err
+	}
+	for {
+		c, err := l.read()
+		if err != nil {
+			return err
+		}
+		if c == '$' && l.peek(len(tag)) == tag {
+			return l.skip(len(tag))
+		}
+	}
+}
+
+// readBlockComment consumes a comment until its closing mark, the first / has already been read.
+// Nested comments are allowed (/* a /* b */ c */)
+func (l *lexer) readBlockComment() error {
+	if _, err := l.read(); err != nil { // the *
+		return err
+	}
+	depth := 1
+	for depth > 0 {
+		c, err := l.read()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '/' && l.peek(1) == "*":
+			depth++
+		case c == '*' && l.peek(1) == "/":
+			depth--
+		default:
+			continue
+		}
+		if _, err := l.read(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || r == '#' || r == '@' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
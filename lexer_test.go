@@ -0,0 +1,246 @@
+package sqlmaper
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lexAll(t *testing.T, s string) []token {
+	return lexTokens(t, newLexer(strings.NewReader(s)))
+}
+
+func lexTokens(t *testing.T, lx *lexer) []token {
+	var toks []token
+	for {
+		tok, err := lx.next()
+		if !assert.Nil(t, err, "error not expected: %v", err) {
+			return toks
+		}
+		if tok.Type == tokEOF {
+			return toks
+		}
+		toks = append(toks, tok)
+	}
+}
+
+func TestLexer(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected []token
+	}{
+		{"", nil},
+		{"select 1;", []token{
+			{Type: tokWord, Text: "select", Line: 1, Col: 1},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 7},
+			{Type: tokWord, Text: "1", Line: 1, Col: 8},
+			{Type: tokDelimiter, Text: ";", Line: 1, Col: 9},
+		}},
+		{"a -- b;\n'c;'", []token{
+			{Type: tokWord, Text: "a", Line: 1, Col: 1},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 2},
+			{Type: tokLineComment, Text: "-- b;", Line: 1, Col: 3},
+			{Type: tokSpace, Text: "\n", Line: 1, Col: 8},
+			{Type: tokString, Text: "'c;'", Line: 2, Col: 1},
+		}},
+		{"/* a\n/* b; */\n*/x", []token{
+			{Type: tokBlockComment, Text: "/* a\n/* b; */\n*/", Line: 1, Col: 1},
+			{Type: tokWord, Text: "x", Line: 3, Col: 3},
+		}},
+		{`"a""b" 'c''d' e'f\'g'`, []token{
+			{Type: tokIdent, Text: `"a""b"`, Line: 1, Col: 1},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 7},
+			{Type: tokString, Text: `'c''d'`, Line: 1, Col: 8},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 14},
+			{Type: tokString, Text: `e'f\'g'`, Line: 1, Col: 15},
+		}},
+		{"x=:id", []token{
+			{Type: tokWord, Text: "x", Line: 1, Col: 1},
+			{Type: tokPunct, Text: "=", Line: 1, Col: 2},
+			{Type: tokPunct, Text: ":", Line: 1, Col: 3},
+			{Type: tokWord, Text: "id", Line: 1, Col: 4},
+		}},
+		{"$$a;$b$$ $1 $x$'$$'$x$ a$b", []token{
+			{Type: tokString, Text: "$$a;$b$$", Line: 1, Col: 1},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 9},
+			{Type: tokWord, Text: "$1", Line: 1, Col: 10},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 12},
+			{Type: tokString, Text: "$x$'$$'$x$", Line: 1, Col: 13},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 23},
+			{Type: tokWord, Text: "a$b", Line: 1, Col: 24},
+		}},
+		{"año;", []token{
+			{Type: tokWord, Text: "año", Line: 1, Col: 1},
+			{Type: tokDelimiter, Text: ";", Line: 1, Col: 4},
+		}},
+	}
+
+	for i, tt := range tests {
+		assert.Equal(t, tt.expected, lexAll(t, tt.feed), tt.feed, "Case: %d", i)
+	}
+}
+
+func TestLexerUnclosed(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected token
+	}{
+		{"x 'not closed;", token{Type: tokString, Text: "'not closed;", Line: 1, Col: 3}},
+		{"x $body$ not closed;", token{Type: tokString, Text: "$body$ not closed;", Line: 1, Col: 3}},
+		{"x \"not closed", token{Type: tokIdent, Text: "\"not closed", Line: 1, Col: 3}},
+		{"x /* a /* b */", token{Type: tokBlockComment, Text: "/* a /* b */", Line: 1, Col: 3}},
+		{"x E'it\\", token{Type: tokString, Text: "E'it\\", Line: 1, Col: 3}},
+	}
+
+	for i, tt := range tests {
+		lx := newLexer(strings.NewReader(tt.feed))
+		lx.next()
+		lx.next()
+		tok, err := lx.next()
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "Case: %d", i)
+		assert.Equal(t, tt.expected, tok, "Case: %d", i)
+		tok, err = lx.next()
+		assert.Nil(t, err, "Case: %d", i)
+		assert.Equal(t, tokEOF, tok.Type, "Case: %d", i)
+	}
+}
+
+func TestLexerBackslash(t *testing.T) {
+	feed := `'it\'s;' "a\"b" 'c:\\' ` + "`d\\`"
+	// by default the backslash is not an escape character, the first literal ends at \'
+	tok, _ := newLexer(strings.NewReader(feed)).next()
+	assert.Equal(t, token{Type: tokString, Text: `'it\'`, Line: 1, Col: 1}, tok)
+
+	assert.Equal(t, []token{
+		{Type: tokString, Text: `'it\'s;'`, Line: 1, Col: 1},
+		{Type: tokSpace, Text: " ", Line: 1, Col: 9},
+		{Type: tokIdent, Text: `"a\"b"`, Line: 1, Col: 10},
+		{Type: tokSpace, Text: " ", Line: 1, Col: 16},
+		{Type: tokString, Text: `'c:\\'`, Line: 1, Col: 17},
+		{Type: tokSpace, Text: " ", Line: 1, Col: 23},
+		{Type: tokIdent, Text: "`d\\`", Line: 1, Col: 24},
+	}, lexTokens(t, newStmtLexer(feed, true)))
+}
+
+func TestLexerDirectives(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected []token
+	}{
+		{"a\n/\nb", []token{
+			{Type: tokWord, Text: "a", Line: 1, Col: 1},
+			{Type: tokSpace, Text: "\n", Line: 1, Col: 2},
+			{Type: tokDelimiter, Text: "/", Line: 2, Col: 1},
+			{Type: tokSpace, Text: "\n", Line: 2, Col: 2},
+			{Type: tokWord, Text: "b", Line: 3, Col: 1},
+		}},
+		{"a / b\n  go  \r\n", []token{
+			{Type: tokWord, Text: "a", Line: 1, Col: 1},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 2},
+			{Type: tokPunct, Text: "/", Line: 1, Col: 3},
+			{Type: tokSpace, Text: " ", Line: 1, Col: 4},
+			{Type: tokWord, Text: "b", Line: 1, Col: 5},
+			{Type: tokSpace, Text: "\n", Line: 1, Col: 6},
+			{Type: tokDelimiter, Text: "  go  ", Line: 2, Col: 1},
+			{Type: tokSpace, Text: "\r\n", Line: 2, Col: 7},
+		}},
+		{"DELIMITER //\nselect 1//", []token{
+			{Type: tokDirective, Text: "DELIMITER //", Line: 1, Col: 1},
+			{Type: tokSpace, Text: "\n", Line: 1, Col: 13},
+			{Type: tokWord, Text: "select", Line: 2, Col: 1},
+			{Type: tokSpace, Text: " ", Line: 2, Col: 7},
+			{Type: tokWord, Text: "1", Line: 2, Col: 8},
+			{Type: tokPunct, Text: "/", Line: 2, Col: 9},
+			{Type: tokPunct, Text: "/", Line: 2, Col: 10},
+		}},
+		{"/* a\n/\n*/ 'b\nGO\n'", []token{
+			{Type: tokBlockComment, Text: "/* a\n/\n*/", Line: 1, Col: 1},
+			{Type: tokSpace, Text: " ", Line: 3, Col: 3},
+			{Type: tokString, Text: "'b\nGO\n'", Line: 3, Col: 4},
+		}},
+		{"going", []token{
+			{Type: tokWord, Text: "going", Line: 1, Col: 1},
+		}},
+	}
+
+	for i, tt := range tests {
+		assert.Equal(t, tt.expected, lexAll(t, tt.feed), tt.feed, "Case: %d", i)
+	}
+
+	lx := newLexer(strings.NewReader("end$$ x"))
+	lx.delim = "$$"
+	assert.Equal(t, []token{
+		{Type: tokWord, Text: "end", Line: 1, Col: 1},
+		{Type: tokDelimiter, Text: "$$", Line: 1, Col: 4},
+		{Type: tokSpace, Text: " ", Line: 1, Col: 6},
+		{Type: tokWord, Text: "x", Line: 1, Col: 7},
+	}, lexTokens(t, lx))
+}
+
+func TestDelimiterDirective(t *testing.T) {
+	var tests = []struct {
+		feed  string
+		delim string
+		ok    bool
+	}{
+		{"DELIMITER //", "//", true},
+		{"delimiter $$", "$$", true},
+		{"delimiter ;", ";", true},
+		{"DELIMITER /", "", true},
+		{"DELIMITER", "", false},
+		{"DELIMITER a b", "", false},
+		{"DELIMITERS //", "", false},
+	}
+
+	for i, tt := range tests {
+		delim, ok := delimiterDirective(tt.feed)
+		assert.Equal(t, tt.ok, ok, "Case: %d", i)
+		assert.Equal(t, tt.delim, delim, "Case: %d", i)
+	}
+}
+
+func TestLexerLimit(t *testing.T) {
+	lx := newLexer(strings.NewReader("'a very long literal';x"))
+	lx.limit = 5
+	tok, err := lx.next()
+	assert.Nil(t, err)
+	assert.Equal(t, token{Type: tokString, Text: "'a ve", Line: 1, Col: 1}, tok)
+
+	tok, err = lx.next()
+	assert.Nil(t, err)
+	assert.Equal(t, token{Type: tokDelimiter, Text: ";", Line: 1, Col: 22}, tok)
+
+	lx = newLexer(strings.NewReader("-- tag:fileName= long_name.csv"))
+	lx.limit = 5
+	tok, err = lx.next()
+	assert.Nil(t, err)
+	assert.Equal(t, token{Type: tokLineComment, Text: "-- tag:fileName= long_name.csv", Line: 1, Col: 1}, tok)
+
+	lx = newLexer(strings.NewReader("a//b"))
+	lx.delim = "//"
+	lx.limit = 1
+	assert.Equal(t, []token{
+		{Type: tokWord, Text: "a", Line: 1, Col: 1},
+		{Type: tokDelimiter, Text: "/", Line: 1, Col: 2},
+		{Type: tokWord, Text: "b", Line: 1, Col: 4},
+	}, lexTokens(t, lx))
+}
+
+var resultLexer int
+
+func BenchmarkLexer(b *testing.B) {
+	var r int
+	for i := 0; i < b.N; i++ {
+		lx := newLexer(strings.NewReader("insert /*+ append */ into peoples select * from aux_peoples where name <> 'it''s'; -- comment"))
+		for {
+			tok, _ := lx.next()
+			if tok.Type == tokEOF {
+				break
+			}
+			r++
+		}
+	}
+	resultLexer = r
+}
@@ -0,0 +1,304 @@
+package sqlmaper
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Param is a named bind parameter of a query (:name)
+type Param struct {
+	Name      string     // name of the parameter without the colon
+	Positions []Position // every place of the sql file where the parameter is used, in order
+	Spec      *ParamSpec // declaration of the parameter in a param tag, nil when it's not declared
+}
+
+// Params returns the named parameters of the query in order of appearance and without duplicates.
+// The colons inside string literals, quoted identifiers and comments, the postgres casts (::) and
+// the numbered placeholders (:1) are not parameters
+func (q Query) Params() []Param {
+	text, start := q.src.Text, q.src.Start
+	if text == "" {
+		// the query was not parsed from a file
+		text, start = q.Query, Position{Line: 1, Column: 1}
+	}
+
+	var params []Param
+	idx := make(map[string]int)
+	walkParams(text, q.backslash, func(tok token, name string) {
+		if name == "" {
+			return
+		}
+		pos := Position{Line: start.Line + tok.Line - 1, Column: tok.Col}
+		if tok.Line == 1 {
+			pos.Column += start.Column - 1
+		}
+		i, ok := idx[name]
+		if !ok {
+			i = len(params)
+			idx[name] = i
+			params = append(params, Param{Name: name})
+			if spec, ok := q.ParamSpec(name); ok {
+				params[i].Spec = &spec
+			}
+		}
+		params[i].Positions = append(params[i].Positions, pos)
+	})
+	return params
+}
+
+// walkParams calls f with every token of the statement, a named parameter is given as a single
+// token (:name) along with its name, any other token has an empty name
+func walkParams(stmt string, backslash bool, f func(tok token, name string)) {
+	lx := newStmtLexer(stmt, backslash)
+	var colon *token
+	for {
+		tok, err := lx.next()
+		if (err != nil && err != io.ErrUnexpectedEOF) || tok.Type == tokEOF {
+			// an unclosed literal is still part of the statement
+			break
+		}
+
+		if colon != nil {
+			prev := *colon
+			colon = nil
+			switch {
+			case tok.Type == tokPunct && tok.Text == ":":
+				// a cast (::), none of the colons starts a parameter
+				prev.Text += tok.Text
+				f(prev, "")
+				continue
+			case tok.Type == tokWord && isParamStart(tok.Text):
+				prev.Text += tok.Text
+				f(prev, tok.Text)
+				continue
+			}
+			f(prev, "")
+		}
+
+		if tok.Type == tokPunct && tok.Text == ":" {
+			colon = &tok
+			continue
+		}
+		f(tok, "")
+	}
+	if colon != nil {
+		f(*colon, "")
+	}
+}
+
+// isParamStart reports if the word after a colon is the name of a parameter
+func isParamStart(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// ParamType is the type of a parameter declared with a param tag (-- tag:param.refDate=date)
+type ParamType int
+
+const (
+	// AnyParam - the value is bound as it is
+	AnyParam ParamType = iota
+	// StringParam - string or text
+	StringParam
+	// IntParam - int or integer, bound as an int64
+	IntParam
+	// FloatParam - float, number or numeric, bound as a float64
+	FloatParam
+	// BoolParam - bool or boolean
+	BoolParam
+	// DateParam - date, a string is converted with the layout 2006-01-02
+	DateParam
+	// TimestampParam - timestamp or datetime, a string is converted from RFC 3339 or 2006-01-02 15:04:05
+	TimestampParam
+)
+
+var paramTypeNames = []string{"any", "string", "int", "float", "bool", "date", "timestamp"}
+
+var paramTypeAliases = map[string]ParamType{
+	"text":     StringParam,
+	"integer":  IntParam,
+	"number":   FloatParam,
+	"numeric":  FloatParam,
+	"boolean":  BoolParam,
+	"datetime": TimestampParam,
+}
+
+// String satisfy stringer interface
+func (t ParamType) String() string {
+	if t >= 0 && int(t) < len(paramTypeNames) {
+		return paramTypeNames[t]
+	}
+	return fmt.Sprintf("ParamType(%d)", int(t))
+}
+
+// ParseParamType returns the parameter type with the given name (eg: "date" or "INT")
+func ParseParamType(name string) (ParamType, error) {
+	lower := strings.ToLower(strings.TrimSpace(name))
+	for i, n := range paramTypeNames {
+		if n == lower {
+			return ParamType(i), nil
+		}
+	}
+	if t, ok := paramTypeAliases[lower]; ok {
+		return t, nil
+	}
+	return AnyParam, fmt.Errorf("unknown parameter type: %q", name)
+}
+
+// ParamSpec is the declaration of a parameter in a param tag, the value of the tag is the type of
+// the parameter optionally followed by required or by default and the value used when the parameter
+// is not given (-- tag:param.refDate=date required or -- tag:param.IdGroup=int default 1)
+type ParamSpec struct {
+	Type       ParamType
+	Required   bool        // a value must be given and it could not be nil
+	Default    interface{} // value used when the parameter is not given, already converted to the type
+	HasDefault bool
+}
+
+// paramTagPrefix is the prefix of the tags that declare a parameter
+const paramTagPrefix = "param."
+
+// ParamSpec returns the declaration of a parameter of the query, the name is not case sensitive
+func (q Query) ParamSpec(name string) (ParamSpec, bool) {
+	v, ok := q.Tags[paramTagPrefix+strings.ToLower(name)]
+	if !ok {
+		return ParamSpec{}, false
+	}
+	spec, err := parseParamSpec(v)
+	return spec, err == nil
+}
+
+// parseParamSpec returns the declaration of a parameter given the value of its param tag
+func parseParamSpec(value string) (ParamSpec, error) {
+	var spec ParamSpec
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return spec, errors.New("parameter without type")
+	}
+
+	var err error
+	if spec.Type, err = ParseParamType(fields[0]); err != nil {
+		return spec, err
+	}
+	if len(fields) == 1 {
+		return spec, nil
+	}
+
+	switch strings.ToLower(fields[1]) {
+	case "required":
+		if len(fields) > 2 {
+			return spec, fmt.Errorf("unexpected %q after required", strings.Join(fields[2:], " "))
+		}
+		spec.Required = true
+	case "default":
+		if len(fields) == 2 {
+			return spec, errors.New("default without value")
+		}
+		// the value is the rest of the tag, it could be quoted to keep its spaces
+		def := strings.TrimSpace(value[strings.Index(strings.ToLower(value), "default")+len("default"):])
+		if len(def) > 1 && def[0] == '\'' && def[len(def)-1] == '\'' {
+			def = strings.Replace(def[1:len(def)-1], "''", "'", -1)
+		}
+		if spec.Default, err = convertParam(spec.Type, def); err != nil {
+			return spec, fmt.Errorf("invalid default: %v", err)
+		}
+		spec.HasDefault = true
+	default:
+		return spec, fmt.Errorf("unexpected %q after the type, required or default expected", fields[1])
+	}
+	return spec, nil
+}
+
+// layouts of the timestamps given as strings
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02"}
+
+// convertParam returns the value converted to the type of the parameter. The values that implement
+// driver.Valuer (eg: sql.NullString) are not converted
+func convertParam(typ ParamType, v interface{}) (interface{}, error) {
+	if _, ok := v.(driver.Valuer); ok || typ == AnyParam || v == nil {
+		return v, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	v = rv.Interface()
+	var s string
+	if rv.Kind() == reflect.String {
+		s = strings.TrimSpace(rv.String())
+	}
+
+	switch typ {
+	case StringParam:
+		switch {
+		case rv.Kind() == reflect.String:
+			return rv.String(), nil
+		case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+			return string(rv.Bytes()), nil
+		}
+
+	case IntParam:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if rv.Uint() > math.MaxInt64 {
+				return nil, fmt.Errorf("%d overflows an int64", rv.Uint())
+			}
+			return int64(rv.Uint()), nil
+		case reflect.String:
+			return strconv.ParseInt(s, 10, 64)
+		}
+
+	case FloatParam:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(rv.Uint()), nil
+		case reflect.Float32, reflect.Float64:
+			return rv.Float(), nil
+		case reflect.String:
+			return strconv.ParseFloat(s, 64)
+		}
+
+	case BoolParam:
+		switch rv.Kind() {
+		case reflect.Bool:
+			return rv.Bool(), nil
+		case reflect.String:
+			return strconv.ParseBool(s)
+		}
+
+	case DateParam, TimestampParam:
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		if rv.Kind() != reflect.String {
+			break
+		}
+		if typ == DateParam {
+			return time.Parse("2006-01-02", s)
+		}
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", v, typ)
+}
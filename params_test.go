@@ -0,0 +1,192 @@
+package sqlmaper
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParams(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected []string
+	}{
+		{"select 1 from dual", nil},
+		{"select * from peoples where ID = :ID", []string{"ID"}},
+		{"select * from peoples where Birth between :from and :to and Group = :IdGroup", []string{"from", "to", "IdGroup"}},
+		{"select * from peoples where Name = :name or Nick = :name", []string{"name"}},
+		{"select to_char(Birth, 'HH24:MI') from peoples where ID = :ID", []string{"ID"}},
+		{"select to_char(Birth, 'HH24::MI') from peoples", nil},
+		{"select ID::text, :value::int from peoples", []string{"value"}},
+		{"select \"a:b\", `c:d` from peoples -- where ID = :ID", nil},
+		{"select /* :hidden */ a from peoples where b = :_b1", []string{"_b1"}},
+		{"select arr[1:2] from peoples where ID = :1", nil},
+		{"select $$ :body $$, E'it\\'s :x' from dual", nil},
+		{"begin x := 1; end", nil},
+		{"select * from peoples where ID = :", nil},
+		{"select :año from dual", []string{"año"}},
+	}
+
+	for i, tt := range tests {
+		var names []string
+		for _, p := range (Query{Query: tt.feed}).Params() {
+			names = append(names, p.Name)
+		}
+		assert.Equal(t, tt.expected, names, tt.feed, "Case: %d", i)
+	}
+}
+
+func TestParamsPositions(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+  select * from peoples
+   where IdGroup = :IdGroup and to_char(Birth, 'HH24:MI') = :time
+     and (IdGroup > 0 or :IdGroup is null);
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, []Param{
+		{Name: "IdGroup", Positions: []Position{{Line: 3, Column: 20}, {Line: 4, Column: 26}}},
+		{Name: "time", Positions: []Position{{Line: 3, Column: 61}}},
+	}, queries.Query("peoples").Params())
+
+	queries, err = ParseReader(strings.NewReader("-- tag:name= Peoples\n  select * from peoples where ID = :ID;"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, []Param{{Name: "ID", Positions: []Position{{Line: 2, Column: 36}}}}, queries.Query("peoples").Params())
+}
+
+func TestParseParamSpec(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected ParamSpec
+		err      string
+	}{
+		{"date", ParamSpec{Type: DateParam}, ""},
+		{"DATE required", ParamSpec{Type: DateParam, Required: true}, ""},
+		{"int default 1", ParamSpec{Type: IntParam, Default: int64(1), HasDefault: true}, ""},
+		{"integer DEFAULT -7", ParamSpec{Type: IntParam, Default: int64(-7), HasDefault: true}, ""},
+		{"text default 'Leo ''the boss'''", ParamSpec{Type: StringParam, Default: "Leo 'the boss'", HasDefault: true}, ""},
+		{"bool default true", ParamSpec{Type: BoolParam, Default: true, HasDefault: true}, ""},
+		{"number default 1.5", ParamSpec{Type: FloatParam, Default: 1.5, HasDefault: true}, ""},
+		{"date default 2020-02-29", ParamSpec{Type: DateParam, Default: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), HasDefault: true}, ""},
+		{"any", ParamSpec{}, ""},
+		{"", ParamSpec{}, "parameter without type"},
+		{"money", ParamSpec{}, `unknown parameter type: "money"`},
+		{"int default", ParamSpec{Type: IntParam}, "default without value"},
+		{"int default one", ParamSpec{Type: IntParam}, `invalid default: strconv.ParseInt: parsing "one": invalid syntax`},
+		{"int required please", ParamSpec{Type: IntParam, Required: true}, `unexpected "please" after required`},
+		{"int optional", ParamSpec{Type: IntParam}, `unexpected "optional" after the type, required or default expected`},
+	}
+
+	for i, tt := range tests {
+		spec, err := parseParamSpec(tt.feed)
+		if tt.err != "" {
+			if assert.NotNil(t, err, "error expected - Case: %d", i) {
+				assert.Equal(t, tt.err, err.Error(), "Case: %d", i)
+			}
+			continue
+		}
+		assert.Nil(t, err, "error not expected: %v - Case: %d", err, i)
+		assert.Equal(t, tt.expected, spec, "Case: %d", i)
+	}
+}
+
+func TestConvertParam(t *testing.T) {
+	type myInt int
+	ts := time.Date(2021, 3, 4, 10, 30, 0, 0, time.UTC)
+	n := 5
+	var nilInt *int
+
+	var tests = []struct {
+		typ      ParamType
+		feed     interface{}
+		expected interface{}
+		err      bool
+	}{
+		{AnyParam, struct{}{}, struct{}{}, false},
+		{IntParam, nil, nil, false},
+		{IntParam, nilInt, nil, false},
+		{IntParam, &n, int64(5), false},
+		{IntParam, myInt(3), int64(3), false},
+		{IntParam, uint8(3), int64(3), false},
+		{IntParam, " 42 ", int64(42), false},
+		{IntParam, 1.5, nil, true},
+		{FloatParam, 2, float64(2), false},
+		{FloatParam, float32(0.5), float64(0.5), false},
+		{FloatParam, "3.25", 3.25, false},
+		{StringParam, "Leo", "Leo", false},
+		{StringParam, []byte("Leo"), "Leo", false},
+		{StringParam, 1, nil, true},
+		{BoolParam, "false", false, false},
+		{BoolParam, true, true, false},
+		{BoolParam, "maybe", nil, true},
+		{DateParam, "2021-03-04", time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), false},
+		{DateParam, ts, ts, false},
+		{DateParam, "04/03/2021", nil, true},
+		{TimestampParam, "2021-03-04T10:30:00Z", ts, false},
+		{TimestampParam, "2021-03-04 10:30:00", ts, false},
+		{TimestampParam, "yesterday", nil, true},
+		{TimestampParam, 7, nil, true},
+		{IntParam, sql.NullString{String: "x", Valid: true}, sql.NullString{String: "x", Valid: true}, false},
+	}
+
+	for i, tt := range tests {
+		v, err := convertParam(tt.typ, tt.feed)
+		assert.Equal(t, tt.err, err != nil, "Case: %d - %v", i, err)
+		if !tt.err {
+			assert.Equal(t, tt.expected, v, "Case: %d", i)
+		}
+	}
+	assert.Equal(t, "timestamp", TimestampParam.String())
+	assert.Equal(t, "ParamType(12)", ParamType(12).String())
+}
+
+func TestParamTags(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+-- tag:param.refDate= date required
+-- tag:param.IdGroup= int default 1
+select * from peoples where IdGroup = :IdGroup and Birth < :refDate and Name = :name;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	params := queries.Query("peoples").Params()
+	if !assert.Equal(t, 3, len(params)) {
+		return
+	}
+	assert.Equal(t, &ParamSpec{Type: IntParam, Default: int64(1), HasDefault: true}, params[0].Spec)
+	assert.Equal(t, &ParamSpec{Type: DateParam, Required: true}, params[1].Spec)
+	assert.Nil(t, params[2].Spec)
+
+	spec, ok := queries.Query("peoples").ParamSpec("REFDATE")
+	assert.True(t, ok)
+	assert.Equal(t, ParamSpec{Type: DateParam, Required: true}, spec)
+	_, ok = queries.Query("peoples").ParamSpec("name")
+	assert.False(t, ok)
+
+	var tests = []struct {
+		feed     string
+		expected string
+	}{
+		{"-- tag:name= Test1\n-- tag:param.refDate= money\nselect :refDate from dual;", `2:1: tag "param.refdate": unknown parameter type: "money"`},
+		{"-- tag:name= Test1\n-- tag:param.= int\nselect 1 from dual;", `2:1: tag "param." without parameter name`},
+		{"-- tag:name= Test1\n-- tag:param.a= int\n-- tag:param.b= int\nselect :A from dual;", `3:1: parameter "b" declared but not used by the statement`},
+	}
+	for i, tt := range tests {
+		_, err := ParseReader(strings.NewReader(tt.feed))
+		var pe *ParseError
+		if !assert.True(t, errors.As(err, &pe), "ParseError expected - Case: %d", i) {
+			continue
+		}
+		assert.Equal(t, InvalidTag, pe.Kind, "Case: %d", i)
+		assert.Equal(t, tt.expected, err.Error(), "Case: %d", i)
+	}
+}
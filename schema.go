@@ -0,0 +1,112 @@
+package sqlmaper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TagSchema describes the tags that could be used in a sql file, it's set in ParseOptions.Schema
+// and every problem is reported as a SchemaViolation with the position of the tag (or the statement).
+// The tags handled by the package (name, delimiter, type, concurrent, depends, tx and param.*) are always allowed
+type TagSchema struct {
+	// Tags are the allowed tags and the rules for their values, the names are not case sensitive
+	Tags map[string]TagRule
+
+	// AllowUnknown lets the tags that are not in Tags pass without checking them, so the schema
+	// only checks the values and the required tags
+	AllowUnknown bool
+
+	// Required are the tags that every query must have
+	Required []string
+
+	// RequiredByKind are the tags that the queries of a kind must have (eg: DML: {"owner"})
+	RequiredByKind map[QueryKind][]string
+}
+
+// TagRule constrains the values of a tag
+type TagRule struct {
+	Pattern *regexp.Regexp // the value must match it, nil means any value
+	Enum    []string       // the value must be one of them (not case sensitive), empty means any value
+}
+
+// builtinTags are the tags handled by the package, they are allowed by any schema
+var builtinTags = map[string]bool{"name": true, "delimiter": true, "type": true, "concurrent": true, dependsTag: true, txTag: true}
+
+// check returns the problem of a tag and its value, if any
+func (s *TagSchema) check(tag, value string) (string, bool) {
+	if builtinTags[tag] || strings.HasPrefix(tag, paramTagPrefix) {
+		return "", true
+	}
+
+	rule, ok := s.rule(tag)
+	if !ok {
+		if s.AllowUnknown {
+			return "", true
+		}
+		if similar := s.similar(tag); similar != "" {
+			return fmt.Sprintf("tag %q not in the schema (did you mean %q?)", tag, similar), false
+		}
+		return fmt.Sprintf("tag %q not in the schema", tag), false
+	}
+
+	if len(rule.Enum) > 0 {
+		found := false
+		for _, e := range rule.Enum {
+			if strings.EqualFold(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("tag %q with value %q, expected one of: %s", tag, value, strings.Join(rule.Enum, ", ")), false
+		}
+	}
+	if rule.Pattern != nil && !rule.Pattern.MatchString(value) {
+		return fmt.Sprintf("tag %q with value %q that does not match %s", tag, value, rule.Pattern), false
+	}
+	return "", true
+}
+
+// rule returns the rule of a tag
+func (s *TagSchema) rule(tag string) (TagRule, bool) {
+	if rule, ok := s.Tags[tag]; ok {
+		return rule, true
+	}
+	for name, rule := range s.Tags {
+		if strings.EqualFold(name, tag) {
+			return rule, true
+		}
+	}
+	return TagRule{}, false
+}
+
+// similar returns the tag of the schema that could have been meant by an unknown one,
+// the one that only differs in the dashes or the underscores (file_name for filename)
+func (s *TagSchema) similar(tag string) string {
+	strip := strings.NewReplacer("_", "", "-", "", ".", "")
+	for name := range s.Tags {
+		if strings.EqualFold(strip.Replace(name), strip.Replace(tag)) {
+			return strings.ToLower(name)
+		}
+	}
+	return ""
+}
+
+// missing returns the required tags that a query of the given kind has not, sorted by name
+func (s *TagSchema) missing(kind QueryKind, tags map[string]string) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	required := append(append([]string(nil), s.Required...), s.RequiredByKind[kind]...)
+	for _, tag := range required {
+		tag = strings.ToLower(tag)
+		if _, ok := tags[tag]; ok || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		missing = append(missing, tag)
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,88 @@
+package sqlmaper
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchema = &TagSchema{
+	Tags: map[string]TagRule{
+		"fileName": {Pattern: regexp.MustCompile(`^[\w.-]+\.(psv|csv)$`)},
+		"owner":    {},
+		"env":      {Enum: []string{"dev", "prod"}},
+	},
+	Required:       []string{"owner"},
+	RequiredByKind: map[QueryKind][]string{DQL: {"filename"}},
+}
+
+func TestSchema(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected string
+	}{
+		{"-- tag:name= Test1\n-- tag:owner= leo\n-- tag:FileName= peoples.psv\n-- tag:env= PROD\nselect 1 from dual;", ""},
+		{"-- tag:name= Test1\n-- tag:owner= leo\n-- tag:delimiter= ;\n-- tag:type= DML\n-- tag:param.a= int\nupdate t set a = :a;", ""},
+		{"-- tag:name= Test1\n-- tag:owner= leo\n-- tag:file_name= peoples.psv\nselect 1 from dual;", `3:1: tag "file_name" not in the schema (did you mean "filename"?)`},
+		{"-- tag:name= Test1\n-- tag:owner= leo\n-- tag:hash= 1\nupdate t set a = 1;", `3:1: tag "hash" not in the schema`},
+		{"-- tag:name= Test1\n-- tag:owner= leo\n-- tag:fileName= peoples.txt\nselect 1 from dual;", `3:1: tag "filename" with value "peoples.txt" that does not match ^[\w.-]+\.(psv|csv)$`},
+		{"-- tag:name= Test1\n-- tag:owner= leo\n-- tag:env= qa\nupdate t set a = 1;", `3:1: tag "env" with value "qa", expected one of: dev, prod`},
+		{"-- tag:name= Test1\n-- tag:owner= leo\n  select 1 from dual;", `3:3: query "Test1" of type DQL without the required tag "filename"`},
+		{"-- tag:name= Test1\nupdate t set a = 1;", `2:1: query "Test1" of type DML without the required tag "owner"`},
+	}
+
+	for i, tt := range tests {
+		_, err := ParseOptions{Schema: testSchema}.ParseReader(strings.NewReader(tt.feed))
+		if tt.expected == "" {
+			assert.Nil(t, err, "error not expected: %v - Case: %d", err, i)
+			continue
+		}
+		var pe *ParseError
+		if !assert.True(t, errors.As(err, &pe), "ParseError expected - Case: %d", i) {
+			continue
+		}
+		assert.Equal(t, SchemaViolation, pe.Kind, "Case: %d", i)
+		assert.Equal(t, "Test1", pe.Query, "Case: %d", i)
+		assert.Equal(t, tt.expected, err.Error(), "Case: %d", i)
+
+		_, err = ParseReader(strings.NewReader(tt.feed))
+		assert.Nil(t, err, "without schema - Case: %d", i)
+	}
+
+	schema := &TagSchema{AllowUnknown: true, Tags: map[string]TagRule{"env": {Enum: []string{"dev"}}}}
+	_, err := ParseOptions{Schema: schema}.ParseReader(strings.NewReader("-- tag:name= Test1\n-- tag:hash= 1\nselect 1 from dual;"))
+	assert.Nil(t, err, "error not expected: %v", err)
+	_, err = ParseOptions{Schema: schema}.ParseReader(strings.NewReader("-- tag:name= Test1\n-- tag:env= prod\nselect 1 from dual;"))
+	assert.Equal(t, `2:1: tag "env" with value "prod", expected one of: dev`, err.Error())
+}
+
+func TestSchemaAllErrors(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+-- tag:fileName= peoples.psv
+-- tag:filname= peoples.psv
+select * from peoples;
+-- tag:name= Update1
+-- tag:owner= leo
+update peoples set Name = 'Leo' where ID = 1;
+`
+	dir, err := ioutil.TempDir("", "sqlmaper")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queries.sql")
+	if !assert.Nil(t, ioutil.WriteFile(path, []byte(sqlFile), 0644)) {
+		return
+	}
+
+	queries, err := ParseOptions{Schema: testSchema, AllErrors: true}.ParseFile(path)
+	assert.Equal(t, path+`:3:1: tag "filname" not in the schema`+"\n"+path+`:4:1: query "Peoples" of type DQL without the required tag "owner"`, err.Error())
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "schema violation", SchemaViolation.String())
+}
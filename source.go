@@ -0,0 +1,56 @@
+package sqlmaper
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a location inside a sql file, both line and column start at 1
+// and the column is counted in characters (not bytes)
+type Position struct {
+	Line   int
+	Column int
+}
+
+// String satisfy stringer interface
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Source is the place of the sql file where a query was found
+type Source struct {
+	File  string   // file name, empty when the reader has no name
+	Start Position // first character of the statement
+	End   Position // last character of the statement (the terminator is not included)
+	Text  string   // the statement exactly as it is in the file, with its new lines and comments
+}
+
+// String satisfy stringer interface, it returns the location of the query as file:line:column
+func (s Source) String() string {
+	if s.File == "" {
+		return s.Start.String()
+	}
+	return fmt.Sprintf("%s:%s", s.File, s.Start)
+}
+
+// lastPosition returns the position of the last character of a token
+func lastPosition(tok token) Position {
+	text := strings.TrimRight(tok.Text, "\r\n")
+	pos := Position{Line: tok.Line, Column: tok.Col}
+	if i := strings.LastIndex(text, "\n"); i >= 0 {
+		pos.Line += strings.Count(text, "\n")
+		pos.Column = 1
+		text = text[i+1:]
+	}
+	pos.Column += utf8.RuneCountInString(text) - 1
+	return pos
+}
+
+// readerName returns the name of the reader when it has one (eg: *os.File)
+func readerName(r interface{}) string {
+	if n, ok := r.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package sqlmaper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastPosition(t *testing.T) {
+	var tests = []struct {
+		feed     token
+		expected Position
+	}{
+		{token{Text: "a", Line: 1, Col: 1}, Position{Line: 1, Column: 1}},
+		{token{Text: "select", Line: 3, Col: 5}, Position{Line: 3, Column: 10}},
+		{token{Text: "'año'", Line: 1, Col: 1}, Position{Line: 1, Column: 5}},
+		{token{Text: "/* a\nbb */", Line: 2, Col: 7}, Position{Line: 3, Column: 5}},
+		{token{Text: "-- comment\r", Line: 4, Col: 1}, Position{Line: 4, Column: 10}},
+	}
+
+	for i, tt := range tests {
+		assert.Equal(t, tt.expected, lastPosition(tt.feed), tt.feed.Text, "Case: %d", i)
+	}
+}
+
+func TestSourceString(t *testing.T) {
+	src := Source{Start: Position{Line: 3, Column: 5}}
+	assert.Equal(t, "3:5", src.String())
+	src.File = "queries.sql"
+	assert.Equal(t, "queries.sql:3:5", src.String())
+}
+
+func TestQuerySource(t *testing.T) {
+	sqlFile := `-- tag:name= Select1
+select *
+  from peoples /* all of them */
+ where name <> 'año';
+
+-- tag:name= Update1
+  update peoples set Name = 'Leo' where ID = 1; -- the boss
+`
+	dir, err := ioutil.TempDir("", "sqlmaper")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queries.sql")
+	if !assert.Nil(t, ioutil.WriteFile(path, []byte(sqlFile), 0644)) {
+		return
+	}
+
+	queries, err := ParseFile(path)
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+
+	iter := queries.NewFileOrderIterator()
+	assert.True(t, iter.Iterate())
+	assert.Equal(t, Source{
+		File:  path,
+		Start: Position{Line: 2, Column: 1},
+		End:   Position{Line: 4, Column: 20},
+		Text:  "select *\n  from peoples /* all of them */\n where name <> 'año'",
+	}, iter.Source())
+
+	assert.True(t, iter.Iterate())
+	assert.Equal(t, Source{
+		File:  path,
+		Start: Position{Line: 7, Column: 3},
+		End:   Position{Line: 7, Column: 46},
+		Text:  "update peoples set Name = 'Leo' where ID = 1",
+	}, iter.Source())
+
+	queries, err = ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, "", queries.Query("update1").Source().File)
+	assert.Equal(t, "7:3", queries.Query("update1").Source().String())
+}
@@ -4,27 +4,40 @@
 package sqlmaper
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // Query is a parsed query along with its associated information
 type Query struct {
 	Query string            // SQL statement
-	Type  int               // query tipe (DML, DQL o DDL)
+	Type  QueryKind         // query tipe (DML, DQL o DDL)
 	Tags  map[string]string // additional information in the form of: -- tag_name: tag_value
 	idx   int
+	src   Source
+	norm  string // statement in a single line without the line comments
+	kind  SubKind
+	verb  bool                // the statement keeps its new lines and comments (ParseOptions.Verbatim)
+	esc   Escaper             // nil is SqlxEscaper
+	multi map[string][]string // every value of the repeated tags in order, Tags has the last one
+	txSeq int                 // transaction of the untagged queries ended by a commit or rollback statement, 0 if none follows it
+	// txRollback reports that the transaction of the query is ended by a rollback statement
+	txRollback bool
+	// backslash escapes the quotes in the literals of the statement (ParseOptions.BackslashEscapes)
+	backslash bool
 }
 
 // String satisfy stringer interface
 func (q Query) String() string {
 	var str strings.Builder
+	str.WriteString(fmt.Sprintf("Source: %s", q.src))
 	str.WriteString(fmt.Sprintf("Query: %s", q.Query))
-	str.WriteString(fmt.Sprintf("Type: %d", q.Type))
+	str.WriteString(fmt.Sprintf("Type: %s", q.Type))
 	for tag, value := range q.Tags {
 		str.WriteString(fmt.Sprintf("Tag: %s - Value: %s", tag, value))
 	}
@@ -36,12 +49,90 @@ func (q Query) Statement() string {
 	return q.Query
 }
 
+// Normalized returns the statement ready to be executed in a single line and without line comments,
+// this is the default Statement unless ParseOptions.Verbatim is set
+func (q Query) Normalized() string {
+	return q.escape(q.norm)
+}
+
+// Verbatim returns the statement ready to be executed exactly as it is in the file, with its new lines
+// and comments, this is the Statement when ParseOptions.Verbatim is set
+func (q Query) Verbatim() string {
+	return q.escape(q.src.Text)
+}
+
+// Raw returns the statement without escaping, exactly as it is in the file when ParseOptions.Verbatim
+// is set or normalized otherwise. It's the statement to use with database/sql (see Rebind and Bind)
+func (q Query) Raw() string {
+	switch {
+	case q.verb:
+		return q.src.Text
+	case q.norm != "":
+		return q.norm
+	}
+	// the query was not parsed from a file
+	return q.Query
+}
+
+// escape returns the statement escaped with the escaper of the query (ParseOptions.Escaper)
+func (q Query) escape(stmt string) string {
+	if q.esc == nil {
+		return scapeColons(stmt, q.backslash)
+	}
+	return q.esc(stmt)
+}
+
 // QueryType is a helper function to get the type of the query
-func (q Query) QueryType() int {
+func (q Query) QueryType() QueryKind {
 	return q.Type
 }
 
-// TagValue is a helper function to get the value of the given query tag identifier (label)
+// Transaction returns the name of the transaction of the query, the queries with the same one are run
+// together in a transaction by the Executor. It's the value of the tx tag (-- tag:tx= load_1) or, without
+// it, the transaction ended by the next commit or rollback statement of the file, named after that statement
+// and numbered in the order of the file: the queries before the first one are in "commit#1" (or "rollback#1"),
+// the ones between the first and the second in "commit#2", etc. A query with a tx tag also ends the transaction
+// of the untagged queries before it, the ones after it are in the next one. The Executor rolls back the
+// rollback transactions. An empty name means that the query is not in a transaction
+func (q Query) Transaction() string {
+	if v, ok := q.Tags[txTag]; ok {
+		return strings.TrimSpace(v)
+	}
+	switch {
+	case q.txSeq > 0 && q.txRollback:
+		return fmt.Sprintf("rollback#%d", q.txSeq)
+	case q.txSeq > 0:
+		return fmt.Sprintf("commit#%d", q.txSeq)
+	}
+	return ""
+}
+
+// txTag is the tag to set the transaction of a query
+const txTag = "tx"
+
+// Concurrent reports if the query could be executed concurrently with other queries,
+// by default only the DQL queries could but the concurrent tag overrides it
+func (q Query) Concurrent() bool {
+	if v, ok := q.Tags["concurrent"]; ok {
+		if c, err := strconv.ParseBool(v); err == nil {
+			return c
+		}
+	}
+	return q.Type == DQL
+}
+
+// SubKind returns the precise kind of statement of the query (eg: CreateTable)
+func (q Query) SubKind() SubKind {
+	return q.kind
+}
+
+// Source returns the place of the sql file where the query was found and its original text
+func (q Query) Source() Source {
+	return q.src
+}
+
+// TagValue is a helper function to get the value of the given query tag identifier (label),
+// the last value is returned for a repeated tag (see TagValues)
 func (q Query) TagValue(tag string) string {
 	v, ok := q.Tags[strings.ToLower(tag)]
 	if !ok {
@@ -55,43 +146,78 @@ func (q Query) TagValue(tag string) string {
 // Accessing the map by an ordered key ensures that the sentences are processed in the order in which they are in the parsed sql file
 type Queries map[string]*Query // the will be the value of the special tag "-- name:"
 
+// QueryKind is the type of a query statement (DML, DQL, DDL, etc)
+type QueryKind int
+
 const (
 	// UKN - Unknow
-	UKN = iota
+	UKN QueryKind = iota
 	// DML - Data Manipulation Languaje (insert, update, etc)
 	DML
 	// DQL - Data Query Languaje (select)
 	DQL
 	// DDL - Data Definition Languaje (create, drop, etc)
 	DDL
+	// DCL - Data Control Languaje (grant, revoke)
+	DCL
+	// TCL - Transaction Control Languaje (commit, rollback, savepoint, etc)
+	TCL
+	// PRC - Procedural code (call to stored procedures and anonymous blocks)
+	PRC
+)
+
+var queryKindNames = []string{"UKN", "DML", "DQL", "DDL", "DCL", "TCL", "PRC"}
+
+// String satisfy stringer interface
+func (k QueryKind) String() string {
+	if k >= 0 && int(k) < len(queryKindNames) {
+		return queryKindNames[k]
+	}
+	return fmt.Sprintf("QueryKind(%d)", int(k))
+}
+
+// MarshalText satisfy encoding.TextMarshaler interface, the kind is encoded by its name (eg: "DQL")
+func (k QueryKind) MarshalText() ([]byte, error) {
+	if k < 0 || int(k) >= len(queryKindNames) {
+		return nil, fmt.Errorf("invalid query kind: %d", int(k))
+	}
+	return []byte(queryKindNames[k]), nil
+}
+
+// UnmarshalText satisfy encoding.TextUnmarshaler interface
+func (k *QueryKind) UnmarshalText(text []byte) error {
+	kind, err := ParseQueryKind(string(text))
+	if err != nil {
+		return err
+	}
+	*k = kind
+	return nil
+}
+
+// ParseQueryKind returns the kind with the given name (eg: "dml" or "DML")
+func ParseQueryKind(name string) (QueryKind, error) {
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	for i, n := range queryKindNames {
+		if n == upper {
+			return QueryKind(i), nil
+		}
+	}
+	return UKN, fmt.Errorf("unknown query kind: %q", name)
+}
 
+const (
 	// TagRegularRegExp is a regular expression to get the regular tags (-- tag:*=)
-	TagRegularRegExp = "(?i)^\\s*--\\s*tag\\s*:\\s*[a-z0-9_-]+\\s*=\\s*"
+	TagRegularRegExp = "(?i)^\\s*--\\s*tag\\s*:\\s*[a-z0-9_.-]+\\s*=\\s*"
 
 	// TagPrefixRegExp is a regular expression to get the prefix of the regular tags (-- tag:)
 	TagPrefixRegExp = "(?i)^\\s*--\\s*tag\\s*:\\s*"
 )
 
-const (
-	lineName = iota
-	lineQuery
-	lastLineQuery
-	lineTag
-	lineToSkip
-	lineComment
-)
-
 var (
 	reTagRegular = regexp.MustCompile(TagRegularRegExp)
 	reTagPrefix  = regexp.MustCompile(TagPrefixRegExp)
 )
 
-type parsedLine struct {
-	Type  int
-	Tag   string
-	Value string
-}
-
 // Query is a helper function to get the Query of the given label (tag=name value)
 func (q Queries) Query(label string) *Query {
 	query, ok := q[label]
@@ -122,7 +248,7 @@ func (q Queries) TagValue(label, tag string) string {
 }
 
 // QueryType is a helper to obtain the type of a given query
-func (q Queries) QueryType(label string) int {
+func (q Queries) QueryType(label string) QueryKind {
 	label = strings.ToLower(label)
 	v, ok := q[label]
 	if !ok {
@@ -133,13 +259,7 @@ func (q Queries) QueryType(label string) int {
 
 // ParseFile reads a file and returns Queries or an error
 func ParseFile(path string) (Queries, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	return ParseReader(file)
+	return ParseOptions{}.ParseFile(path)
 }
 
 // OrderedNames contains a list of query names sorted by the order
@@ -149,126 +269,707 @@ func ParseFile(path string) (Queries, error) {
 type OrderedNames []string
 
 // ParseReader process the stream and returns Queries or an error
+// When the reader has a Name method (like *os.File) it's used as the file name of the queries Source
+// The errors returned are always a *ParseError
 func ParseReader(r io.Reader) (Queries, error) {
-	var (
-		queries = make(Queries)
-		q       *Query
-		qName   string
-		scn     = bufio.NewScanner(r)
-		idx     int
-	)
-
-	FF := true // Fast Forward
-	for scn.Scan() {
-		pl := parseLine(scn.Text())
-		switch pl.Type {
-		case lineToSkip:
-			continue
+	return ParseOptions{}.ParseReader(r)
+}
 
-		case lineName:
-			FF = false
-			qName = strings.ToLower(pl.Value)
-			if _, ok := queries[qName]; ok {
-				return nil, fmt.Errorf("duplicated query name: %q", qName)
-			}
-			q = &Query{}
-			q.Tags = make(map[string]string)
-			q.Tags[strings.ToLower(pl.Tag)] = pl.Value
+// ParseFreeFileReader parse an unstructured query file, the regular sql file that everybody
+// writes without the tags imposed by this package.
+// Every statement gets a name based on its position in the file (query1, query2, etc) unless
+// it has its own name tag, so the Queries could be used exactly as the ones from ParseReader.
+// The last statement of the file does not need a terminator
+func ParseFreeFileReader(r io.Reader) (Queries, error) {
+	return ParseOptions{}.ParseFreeFileReader(r)
+}
+
+// AutoName returns the name given to the unnamed statement found in the n position (starting from 0)
+// of a file parsed by ParseFreeFileReader, when a name tag has already taken it the next free one is used
+func AutoName(n int) string {
+	return fmt.Sprintf("query%d", n+1)
+}
+
+// ParseOptions changes the default behaviour of the parser, its zero value is the behaviour
+// of the ParseFile, ParseReader and ParseFreeFileReader functions
+type ParseOptions struct {
+	// AllErrors keeps parsing after finding a problem and returns every problem found as an ErrorList
+	// along with the queries that could be parsed, so a whole file could be checked in one pass
+	AllErrors bool
+
+	// Strict turns into errors what is silently skipped by default: the tags outside a named block,
+	// the unnamed statements and the commit and rollback statements
+	Strict bool
+
+	// MaxStatementSize is the maximum size in bytes of a statement as it is in the file (comments included),
+	// a bigger statement is reported as an error and it's never held in memory (only its line comments, they could
+	// be tags). The tags are not limited and a name tag ends a statement too large. Zero means no limit
+	MaxStatementSize int
+
+	// Verbatim keeps the statements as they are in the file, with their new lines and comments (optimizer
+	// hints in line comments are not lost and the database error positions are still meaningful).
+	// By default every statement is collapsed into a single line without the line comments
+	Verbatim bool
 
-		case lineTag:
-			if FF {
+	// Escaper prepares the statements of every kind to be executed (Query.Statement), nil means
+	// SqlxEscaper. NoEscaper keeps them as they are and any other function could be used.
+	// The statement without escaping is always given by Query.Raw
+	Escaper Escaper
+
+	// BackslashEscapes makes the backslash an escape character inside the single and double quoted
+	// texts ('it\'s'), as MySQL does by default. Otherwise only a doubled quote is an escaped quote
+	// ('it''s') and the backslash is only an escape character in the postgres E'it\'s' strings
+	BackslashEscapes bool
+
+	// Schema validates the tags of every query (allowed names, values and required tags), nil means
+	// that any tag is allowed
+	Schema *TagSchema
+}
+
+// ParseFile is the same as the ParseFile function but using the options
+func (o ParseOptions) ParseFile(path string) (Queries, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return o.ParseReader(file)
+}
+
+// ParseReader is the same as the ParseReader function but using the options
+func (o ParseOptions) ParseReader(r io.Reader) (Queries, error) {
+	return newParser(r, o).parse()
+}
+
+// ParseFreeFileReader is the same as the ParseFreeFileReader function but using the options
+func (o ParseOptions) ParseFreeFileReader(r io.Reader) (Queries, error) {
+	p := newParser(r, o)
+	p.autoName = true
+	return p.parse()
+}
+
+// parser builds the Queries from the tokens of the lexer
+type parser struct {
+	lx        *lexer
+	opts      ParseOptions
+	queries   Queries
+	idx       int
+	errs      ErrorList
+	q         *Query   // query waiting for its statement, nil when fast forwarding (tags and statements are skipped)
+	qPos      Position // position of the name tag of q
+	commented bool     // there are comments between the tags of q and its statement (it could be commented out)
+	named     bool     // a name tag was found
+	autoName  bool     // the unnamed statements are kept with a generated name instead of being skipped
+	file      string
+	stmt      strings.Builder // normalized statement
+	raw       strings.Builder // original statement
+	start     Position
+	end       Position
+	space     string              // whitespace found after the last token written in stmt
+	nl        bool                // the pending whitespace contains a new line
+	tooLarge  bool                // the statement being built exceeds MaxStatementSize, it's discarded until its terminator
+	delim     string              // delimiter of the file, a query could have its own one with the delimiter tag
+	blocks    blocks              // compound statements of the statement being built
+	line      int                 // line where the last named statement ended
+	lineQuery *Query              // last named statement, the statements starting in its last line are named after it
+	lineCount int                 // statements found in that line
+	qParams   map[string]Position // param tags of q, the parameters must be used by its statement
+	tx        int                 // last transaction of the untagged queries
+	txOpen    bool                // the next untagged query is added to the transaction tx
+	txPending []int               // transactions waiting for a commit or rollback statement
+	txEnds    map[int]bool        // transactions ended, true when it's by a rollback statement
+	unclosed  bool                // the stream ended inside a literal, a quoted identifier or a comment
+}
+
+func newParser(r io.Reader, opts ParseOptions) *parser {
+	p := &parser{
+		lx:      newLexer(r),
+		opts:    opts,
+		queries: make(Queries),
+		file:    readerName(r),
+		delim:   ";",
+	}
+	p.lx.backslash = opts.BackslashEscapes
+	if opts.MaxStatementSize > 0 {
+		// a token bigger than the limit is enough to know that the statement is too large
+		p.lx.limit = opts.MaxStatementSize + 1
+	}
+	return p
+}
+
+func (p *parser) parse() (Queries, error) {
+	for {
+		tok, err := p.lx.next()
+		if err == io.ErrUnexpectedEOF {
+			// the stream ends inside a literal, a quoted identifier or a comment, the statement is unterminated
+			p.unclosed, err = true, nil
+		}
+		if err != nil {
+			// the stream can't be read anymore, it's the last problem reported
+			return p.result(p.fail(ReadFailure, Position{Line: p.lx.line, Column: p.lx.col}, "", err, "reading sql: %v", err))
+		}
+
+		if p.tooLarge {
+			switch tok.Type {
+			case tokEOF:
+				return p.result(nil)
+			case tokDelimiter:
+				p.tooLarge = false
+				p.lx.delim = p.delim
+				continue
+			case tokLineComment:
+				// the statement had no terminator, a name tag starts the next query
+				if tag, _, ok := parseTag(tok.Text); ok && tag == "name" {
+					p.tooLarge = false
+					p.lx.delim = p.delim
+					break
+				}
+				continue
+			default:
 				continue
 			}
-			q.Tags[strings.ToLower(pl.Tag)] = pl.Value
+		}
+
+		p.blocks.token(tok)
 
-		case lineQuery, lastLineQuery:
-			if FF {
+		switch tok.Type {
+		case tokEOF:
+			return p.result(p.close())
+
+		case tokSpace:
+			if p.stmt.Len() == 0 {
 				continue
 			}
-			if len(q.Query) > 0 {
-				q.Query += " "
+			if strings.Contains(tok.Text, "\n") {
+				// commit and rollback are line based, they don't need a terminator
+				if isTransactionControl(p.stmt.String()) {
+					if err := p.dropTransactionControl(); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				p.nl = true
+			}
+			p.space += tok.Text
+			p.raw.WriteString(tok.Text)
+
+		case tokLineComment:
+			// the sql sentences could be multilineal and the final result is a single line with the whole sentences
+			// therefor the single line comments are not part of the statement, they could only be tags
+			if p.stmt.Len() > 0 {
+				p.raw.WriteString(tok.Text)
+				p.end = lastPosition(tok)
 			}
-			q.Query += pl.Value
-			if pl.Type == lastLineQuery {
-				FF = true
-				q.Type = sqlType(q.Query)
-				if q.Type != DDL {
-					q.Query = scapeColons(q.Query)
+			err = p.tag(tok)
+
+		case tokBlockComment:
+			p.write(tok, collapseLines(tok.Text))
+
+		case tokDelimiter:
+			// the semicolons inside a compound statement are part of it
+			if tok.Text == ";" && p.lx.delim == ";" {
+				if p.blocks.open() {
+					p.write(tok, tok.Text)
+					break
 				}
-				q.idx = idx
-				queries[qName] = q
-				idx++
 			}
+			err = p.finish()
+
+		case tokDirective:
+			// the delimiter could only be changed between statements
+			if p.stmt.Len() > 0 {
+				p.write(tok, tok.Text)
+				break
+			}
+			p.delim, _ = delimiterDirective(tok.Text)
+			p.lx.delim = p.delim
+
+		default:
+			p.write(tok, tok.Text)
+		}
+
+		if err == nil && p.opts.MaxStatementSize > 0 && p.raw.Len() > p.opts.MaxStatementSize {
+			err = p.discardTooLarge()
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
-	return queries, nil
 }
 
-func sqlType(q string) int {
-	if len(q) < 10 {
-		return UKN
+// result returns the queries and the errors found
+func (p *parser) result(err error) (Queries, error) {
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range p.queries {
+		rollback, ok := p.txEnds[q.txSeq]
+		if !ok {
+			// there is no commit or rollback after the query
+			q.txSeq = 0
+		}
+		q.txRollback = rollback
 	}
+	if p.opts.Strict {
+		if err := p.checkTransactions(); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.errs) > 0 {
+		return p.queries, p.errs
+	}
+	return p.queries, nil
+}
 
-	s := strings.ToUpper(q[:10])
+// fail reports a problem, it returns the error when the parsing should stop
+func (p *parser) fail(kind ErrorKind, pos Position, query string, cause error, format string, args ...interface{}) error {
+	err := &ParseError{
+		Kind:  kind,
+		File:  p.file,
+		Pos:   pos,
+		Query: query,
+		Msg:   fmt.Sprintf(format, args...),
+		Err:   cause,
+	}
+	if !p.opts.AllErrors {
+		return err
+	}
+	p.errs = append(p.errs, err)
+	return nil
+}
 
-	switch s[:6] {
-	case "INSERT", "UPDATE", "DELETE", "MERGE":
-		return DML
-	case "SELECT":
-		return DQL
-	case "CREATE":
-		return DDL
+// close checks the query being built when its block ends (by another name tag or the end of the file)
+func (p *parser) close() error {
+	if p.autoName && p.stmt.Len() > 0 && (p.q == nil || p.q.Tags["name"] == "") {
+		if p.unclosed || p.blocks.open() {
+			return p.fail(UnterminatedQuery, p.start, "", nil, "statement without terminator")
+		}
+		// the last statement of a free file usually has no terminator, it's kept with its generated name
+		return p.finish()
 	}
+	if p.q == nil {
+		if p.stmt.Len() == 0 || p.autoName {
+			return nil
+		}
+		// the text after the terminator of a named statement is not silently lost
+		if p.start.Line == p.line || p.opts.Strict {
+			return p.fail(UnterminatedQuery, p.start, "", nil, "statement without terminator")
+		}
+		return nil
+	}
+	name := p.q.Tags["name"]
+	if p.stmt.Len() > 0 {
+		return p.fail(UnterminatedQuery, p.start, name, nil, "query %q has no terminator", name)
+	}
+	if !p.commented && name != "" {
+		return p.fail(EmptyQuery, p.qPos, name, nil, "query %q has no statement", name)
+	}
+	return nil
+}
 
-	switch s[:5] {
-	case "WITH ":
-		return DQL
+// tag process a comment that could be a tag
+func (p *parser) tag(tok token) error {
+	tag, value, ok := parseTag(tok.Text)
+	if !ok {
+		if p.stmt.Len() == 0 {
+			p.commented = true
+		}
+		return nil
+	}
+	pos := Position{Line: tok.Line, Column: tok.Col}
+
+	if tag == "name" {
+		err := p.close()
+		// a new name discards any unfinished statement
+		p.reset()
+		p.q = nil
+		p.lx.delim = p.delim
+		p.named = true
+		if err != nil {
+			return err
+		}
+
+		name := strings.ToLower(value)
+		if _, ok := p.queries[name]; ok {
+			return p.fail(DuplicatedName, pos, value, nil, "duplicated query name: %q", name)
+		}
+		p.q = &Query{Tags: map[string]string{tag: value}}
+		p.qPos = pos
+		p.qParams = nil
+		p.commented = false
+		return nil
+	}
+
+	if p.q == nil {
+		if !p.autoName {
+			if !p.named {
+				return p.fail(OrphanTag, pos, "", nil, "tag %q before any name tag", tag)
+			}
+			if p.opts.Strict {
+				return p.fail(OrphanTag, pos, "", nil, "tag %q outside a named block", tag)
+			}
+			return nil
+		}
+		p.q = &Query{Tags: make(map[string]string)}
+		p.qPos = pos
+		p.qParams = nil
+		p.commented = false
+	}
+	if p.opts.Schema != nil {
+		if msg, ok := p.opts.Schema.check(tag, value); !ok {
+			if err := p.fail(SchemaViolation, pos, p.q.Tags["name"], nil, "%s", msg); err != nil {
+				return err
+			}
+		}
+	}
+	if prev, ok := p.q.Tags[tag]; ok {
+		// a repeated tag keeps all its values
+		if p.q.multi == nil {
+			p.q.multi = make(map[string][]string)
+		}
+		if _, ok := p.q.multi[tag]; !ok {
+			p.q.multi[tag] = []string{prev}
+		}
+		p.q.multi[tag] = append(p.q.multi[tag], value)
+	}
+	p.q.Tags[tag] = value
+
+	switch tag {
+	case "delimiter":
+		// the query has its own delimiter, the one of the file is restored after its statement
+		if value == "" {
+			return p.fail(InvalidTag, pos, p.q.Tags["name"], nil, "tag %q without value", tag)
+		}
+		p.lx.delim = inlineDelimiter(value)
+	case "type":
+		// the type of the statement is not guessed
+		if _, err := ParseQueryKind(value); err != nil {
+			return p.fail(InvalidTag, pos, p.q.Tags["name"], err, "tag %q with invalid query type %q", tag, value)
+		}
+	case "concurrent":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return p.fail(InvalidTag, pos, p.q.Tags["name"], err, "tag %q with invalid boolean %q", tag, value)
+		}
+	default:
+		if !strings.HasPrefix(tag, paramTagPrefix) {
+			return nil
+		}
+		if tag == paramTagPrefix {
+			return p.fail(InvalidTag, pos, p.q.Tags["name"], nil, "tag %q without parameter name", tag)
+		}
+		if _, err := parseParamSpec(value); err != nil {
+			return p.fail(InvalidTag, pos, p.q.Tags["name"], err, "tag %q: %v", tag, err)
+		}
+		if p.qParams == nil {
+			p.qParams = make(map[string]Position)
+		}
+		p.qParams[strings.TrimPrefix(tag, paramTagPrefix)] = pos
+	}
+	return nil
+}
+
+// checkParams checks that the parameters declared in the param tags of the query are used by its statement
+func (p *parser) checkParams(q *Query) error {
+	if len(p.qParams) == 0 {
+		return nil
+	}
+	used := make(map[string]bool)
+	for _, param := range q.Params() {
+		used[strings.ToLower(param.Name)] = true
+	}
+
+	var unused []string
+	for name := range p.qParams {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return p.qParams[unused[i]].Line < p.qParams[unused[j]].Line
+	})
+	for _, name := range unused {
+		err := p.fail(InvalidTag, p.qParams[name], q.Tags["name"], nil, "parameter %q declared but not used by the statement", name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write adds a token to the statement being built, s is the token text as it should be in the normalized statement
+func (p *parser) write(tok token, s string) {
+	p.raw.WriteString(tok.Text)
+	p.end = lastPosition(tok)
+	if p.stmt.Len() == 0 {
+		p.start = Position{Line: tok.Line, Column: tok.Col}
+	} else {
+		if p.nl {
+			p.stmt.WriteString(" ")
+		} else {
+			p.stmt.WriteString(p.space)
+		}
+	}
+	p.stmt.WriteString(s)
+	p.space = ""
+	p.nl = false
+}
+
+// finish is called when a statement terminator is found
+func (p *parser) finish() error {
+	p.lx.delim = p.delim
+	stmt := p.stmt.String()
+	if isTransactionControl(stmt) {
+		return p.dropTransactionControl()
+	}
+	src := Source{File: p.file, Start: p.start, End: p.end, Text: strings.TrimSpace(p.raw.String())}
+	p.reset()
+	if stmt == "" {
+		return nil
+	}
+	if p.q == nil && !p.autoName {
+		q, err := p.sibling(src.Start)
+		if q == nil || err != nil {
+			return err
+		}
+		p.q = q
+	}
+	if p.q == nil {
+		p.q = &Query{Tags: make(map[string]string)}
+	}
+
+	q := p.q
+	p.q = nil
+	if _, ok := q.Tags["name"]; !ok {
+		// the names already taken by the name tags are skipped
+		n := p.idx
+		for p.queries[AutoName(n)] != nil {
+			n++
+		}
+		q.Tags["name"] = AutoName(n)
+	}
+	q.norm = stmt
+	q.src = src
+	q.Type, q.kind = classify(stmt, p.opts.BackslashEscapes)
+	if v, ok := q.Tags["type"]; ok {
+		q.Type, _ = ParseQueryKind(v)
+	}
+	if p.opts.Schema != nil {
+		for _, tag := range p.opts.Schema.missing(q.Type, q.Tags) {
+			err := p.fail(SchemaViolation, src.Start, q.Tags["name"], nil, "query %q of type %s without the required tag %q", q.Tags["name"], q.Type, tag)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	q.verb = p.opts.Verbatim
+	q.esc = p.opts.Escaper
+	q.backslash = p.opts.BackslashEscapes
+	err := p.checkParams(q)
+	p.qParams = nil
+	if err != nil {
+		return err
+	}
+	if q.verb {
+		q.Query = q.Verbatim()
+	} else {
+		q.Query = q.Normalized()
+	}
+	q.idx = p.idx
+	if _, ok := q.Tags[txTag]; ok {
+		// the untagged queries after it are in another transaction
+		p.txOpen = false
+	} else {
+		if !p.txOpen {
+			p.tx++
+			p.txOpen = true
+			p.txPending = append(p.txPending, p.tx)
+		}
+		q.txSeq = p.tx
 	}
+	p.queries[strings.ToLower(q.Tags["name"])] = q
+	p.idx++
 
-	switch s[:10] {
-	case "DROP TABLE", "DROP INDEX":
-		return DDL
+	if p.line != p.lx.line || p.lineQuery == nil {
+		p.lineQuery = q
+		p.lineCount = 1
 	}
-	return UKN
+	p.line = p.lx.line
+	return nil
 }
 
-// parseLine classify a single line
-func parseLine(line string) parsedLine {
-	line = strings.TrimSpace(line)
-	if line == "" {
-		return parsedLine{Type: lineToSkip}
+// checkTransactions checks that the queries of every transaction are together in the file (strict mode),
+// the Executor runs the queries in the order of the file so it could not run a split transaction
+func (p *parser) checkTransactions() error {
+	for _, q := range splitTransactions(p.queries) {
+		tx := q.Transaction()
+		err := p.fail(SplitTransaction, q.src.Start, q.Tags["name"], nil, "query %q is separated by other queries from its transaction %q", q.Tags["name"], tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitTransactions returns, in the order of the file, the queries that go back to a transaction after
+// other queries. Only the tagged transactions could be split, a tx tag ends the transaction of the
+// commit and rollback statements
+func splitTransactions(queries Queries) []*Query {
+	ordered := make([]*Query, 0, len(queries))
+	for _, q := range queries {
+		ordered = append(ordered, q)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].idx < ordered[j].idx })
+
+	var split []*Query
+	ended := make(map[string]bool) // transactions followed by other queries
+	for i, q := range ordered {
+		tx := q.Transaction()
+		if i == 0 || ordered[i-1].Transaction() == tx {
+			continue
+		}
+		ended[ordered[i-1].Transaction()] = true
+		if tx != "" && ended[tx] {
+			split = append(split, q)
+		}
+	}
+	return split
+}
+
+// sibling returns the query for an unnamed statement that starts in the line where a named statement ended
+// (select 1 from a; select 1 from b;), it's named after the named one (name_2, name_3, etc) and has its tags
+// except the ones about the statement itself (type, concurrent, delimiter and param.*).
+// Other unnamed statements are skipped and nil is returned
+func (p *parser) sibling(start Position) (*Query, error) {
+	if p.lineQuery == nil || start.Line != p.line {
+		if p.opts.Strict {
+			return nil, p.fail(UnnamedQuery, start, "", nil, "statement without name tag")
+		}
+		return nil, nil
 	}
-	if len(line) >= 6 && strings.ToUpper(line[:6]) == "COMMIT" {
-		return parsedLine{Type: lineToSkip}
+
+	base := p.lineQuery.Tags["name"]
+	if p.opts.Strict {
+		return nil, p.fail(SharedLine, start, base, nil, "several statements under the name tag %q", base)
 	}
-	if len(line) >= 8 && strings.ToUpper(line[:8]) == "ROLLBACK" {
-		return parsedLine{Type: lineToSkip}
+
+	p.lineCount++
+	name := fmt.Sprintf("%s_%d", base, p.lineCount)
+	if _, ok := p.queries[strings.ToLower(name)]; ok {
+		return nil, p.fail(DuplicatedName, start, name, nil, "duplicated query name: %q", strings.ToLower(name))
 	}
 
-	if matches := reTagRegular.FindStringSubmatch(line); len(matches) > 0 {
-		tagName := tagName(matches[0])
-		tagType := lineTag
-		if tagName == "name" {
-			tagType = lineName
+	q := &Query{Tags: make(map[string]string, len(p.lineQuery.Tags))}
+	for k, v := range p.lineQuery.Tags {
+		if !statementTag(k) {
+			q.Tags[k] = v
+		}
+	}
+	for k, v := range p.lineQuery.multi {
+		if statementTag(k) {
+			continue
 		}
-		return parsedLine{Type: tagType, Tag: tagName, Value: strings.TrimPrefix(line, matches[0])}
+		if q.multi == nil {
+			q.multi = make(map[string][]string)
+		}
+		q.multi[k] = append([]string(nil), v...)
 	}
+	q.Tags["name"] = name
+	return q, nil
+}
 
-	if strings.HasPrefix(line, "--") {
-		return parsedLine{Type: lineComment}
+// statementTag reports if a tag describes the statement itself, so it's not copied to the siblings
+func statementTag(tag string) bool {
+	switch tag {
+	case "type", "concurrent", "delimiter":
+		return true
 	}
+	return strings.HasPrefix(tag, paramTagPrefix)
+}
 
-	// the sql sentences could be multilineal and the final result is a single line with the whole sentences
-	// therefor is necessary to strip out any single comment that could be at the end of each sql line
-	if pos := strings.Index(line, "--"); pos > 0 {
-		line = strings.TrimSpace(line[:pos])
+// discardTooLarge discards the statement being built and its query because it exceeds the MaxStatementSize
+func (p *parser) discardTooLarge() error {
+	var name string
+	if p.q != nil {
+		name = p.q.Tags["name"]
 	}
+	pos := p.start
+	p.reset()
+	p.q = nil
+	p.tooLarge = true
+	return p.fail(StatementTooLarge, pos, name, nil, "statement bigger than %d bytes", p.opts.MaxStatementSize)
+}
 
-	if isQueryLastLine(line) {
-		return parsedLine{Type: lastLineQuery, Value: line[:len(line)-1]}
+// dropTransactionControl discards the commit or rollback statement being built, they are not kept
+func (p *parser) dropTransactionControl() error {
+	stmt, pos := p.stmt.String(), p.start
+	p.reset()
+	// the untagged statements until the commit or the rollback are a transaction (see Query.Transaction),
+	// a rollback to a savepoint does not end it
+	words := strings.Fields(strings.ToUpper(stmt))
+	rollback := words[0] == "ROLLBACK"
+	next := words[1:]
+	if len(next) > 0 && (next[0] == "WORK" || next[0] == "TRANSACTION" || next[0] == "TRAN") {
+		next = next[1:]
+	}
+	if !rollback || len(next) == 0 || next[0] != "TO" {
+		for _, tx := range p.txPending {
+			if p.txEnds == nil {
+				p.txEnds = make(map[int]bool)
+			}
+			p.txEnds[tx] = rollback
+		}
+		p.txPending = nil
+		p.txOpen = false
+	}
+	if !p.opts.Strict {
+		return nil
 	}
+	return p.fail(TransactionControl, pos, "", nil, "transaction control statement: %q", stmt)
+}
 
-	return parsedLine{Type: lineQuery, Value: line}
+// reset discards the statement being built
+func (p *parser) reset() {
+	p.stmt.Reset()
+	p.raw.Reset()
+	p.blocks = blocks{}
+	p.space = ""
+	p.nl = false
+}
+
+// isTransactionControl returns true for the commit and rollback statements, they are not kept
+func isTransactionControl(stmt string) bool {
+	words := strings.Fields(stmt)
+	if len(words) == 0 {
+		return false
+	}
+	word := strings.ToUpper(words[0])
+	return word == "COMMIT" || word == "ROLLBACK"
+}
+
+// collapseLines turns a multiline text into a single line
+func collapseLines(s string) string {
+	if !strings.Contains(s, "\n") {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	parts := lines[:0]
+	for _, l := range lines {
+		if l = strings.TrimSpace(l); l != "" {
+			parts = append(parts, l)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseTag returns the name and the value of a tag comment (-- tag:name=value)
+func parseTag(comment string) (tag, value string, ok bool) {
+	comment = strings.TrimSpace(comment)
+	match := reTagRegular.FindString(comment)
+	if match == "" {
+		return "", "", false
+	}
+	return tagName(match), strings.TrimPrefix(comment, match), true
 }
 
 // tagName returns the name of the tag in lowercase (eg: --tag:FileName returns filename)
@@ -286,82 +987,57 @@ func tagName(tag string) string {
 	return strings.TrimSpace(strings.ToLower(tag))
 }
 
-// isQueryLastLine returns true if the line ends in ; or if there is a ; before the first comment
-func isQueryLastLine(line string) bool {
-	// sc	-> SemiColon (;)
-	// slc	-> SingleLine Comment (--)
-	// mlco	-> MultiLine Comment Open (/*)
-	// mlcc	-> MultiLine Comment Close (*/)
-
-	sc := strings.Index(line, ";")
-	if sc == -1 {
-		return false
-	}
+// Escaper prepares a statement to be executed, it's called with the statement as it is in the file
+// (or normalized) and returns the statement given by Query.Statement
+type Escaper func(stmt string) string
 
-	slc := strings.Index(line, "--")
-	mlco := strings.Index(line, "/*")
-	mlcc := strings.Index(line, "*/")
-	if slc > 0 && mlco == -1 && mlcc == -1 && slc < sc {
-		return false
-	}
+// SqlxEscaper escapes the statements for the named queries of sqlx, every colon that is not a named
+// parameter is doubled (sqlx reads :: as a colon) even in the postgres casts (x::::int), the literals
+// and the comments. It's the escaper by default.
+// The double colons inside literals, comments and quoted identifiers are taken as already escaped
+func SqlxEscaper(stmt string) string {
+	return scapeColons(stmt, false)
+}
 
-	if mlco > 0 {
-		if mlcc > 0 {
-			if sc > mlco && sc < mlcc {
-				return false
-			}
-		}
-		if sc > mlco && mlcc == -1 {
-			return false
-		}
-	}
-	return true
+// NoEscaper keeps the statements as they are in the file, for the database/sql drivers and the
+// statements without named parameters
+func NoEscaper(stmt string) string {
+	return stmt
 }
 
-// scapeColon scapes every single colon for a safety use of bind variables
-// using sqlx package
-func scapeColons(s string) string {
+// scapeColons scapes every colon that is not a named parameter for a safety use of bind variables
+// using sqlx package, backslash is the ParseOptions.BackslashEscapes of the statement
+func scapeColons(s string, backslash bool) string {
 	if !strings.Contains(s, ":") {
 		return s
 	}
 
-	if !strings.Contains(s, "'") {
-		return s
-	}
-
 	var str strings.Builder
-	str.Grow(len(s) + 10) // at this point I know for sure that at least one colon wil be duplicate so I make some room for 9 more
-
-	fc := strings.Index(s, "'")
-	str.WriteString(s[:fc+1])
-	lit := true
-
-	for i := fc + 1; i < len(s); i++ {
-		str.WriteByte(s[i])
-		if s[i] == '\'' {
-			lit = !lit
-		}
-		if lit {
-			if s[i] == ':' {
-				if i+1 <= len(s)-1 {
-					if s[i+1] == ':' {
-						str.WriteString(":")
-						i++
-						continue
-					}
-				}
-				str.WriteString(":")
-			}
+	str.Grow(len(s) + 10) // at least one colon will be duplicated so I make some room for 9 more
+	walkParams(s, backslash, func(tok token, name string) {
+		switch {
+		case name != "" || !strings.Contains(tok.Text, ":"):
+			str.WriteString(tok.Text)
+		case tok.Type == tokPunct:
+			// single colons and casts
+			str.WriteString(strings.Replace(tok.Text, ":", "::", -1))
+		default:
+			doubleColons(&str, tok.Text)
 		}
-	}
-
+	})
 	return str.String()
 }
 
-//TODO: new idea... parse a regular sql file (the one that everybody writes without
-// the format imposed by this package).
-// The map ID could be a query's hash and the querys name I don't know yet, maybe nothing)
-// ParseFreeFileReader parse an unstructured query file
-func ParseFreeFileReader(r io.Reader) (*Query, error) {
-	return nil, nil
+// doubleColons writes the text with its single colons doubled, the double ones are kept
+func doubleColons(str *strings.Builder, text string) {
+	for i := 0; i < len(text); i++ {
+		str.WriteByte(text[i])
+		if text[i] != ':' {
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == ':' {
+			i++
+		}
+		str.WriteByte(':')
+	}
 }
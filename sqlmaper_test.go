@@ -1,6 +1,7 @@
 package sqlmaper
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -8,36 +9,30 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestParseLine(t *testing.T) {
+func TestParseTag(t *testing.T) {
 	var tests = []struct {
-		feed     string
-		expected parsedLine
+		feed  string
+		tag   string
+		value string
+		ok    bool
 	}{
-		{"", parsedLine{Type: lineToSkip, Tag: "", Value: ""}},
-		{"commit;", parsedLine{Type: lineToSkip, Tag: "", Value: ""}},
-		{" commit", parsedLine{Type: lineToSkip, Tag: "", Value: ""}},
-		{"  commit -- commit de los cambios", parsedLine{Type: lineToSkip, Tag: "", Value: ""}},
-		{"  rollback -- rollback de los cambios", parsedLine{Type: lineToSkip, Tag: "", Value: ""}},
-		{"roll", parsedLine{Type: lineQuery, Tag: "", Value: "roll"}}, // this test is to validate that the string slicing are protected, doesn't matter if the sql sentences is not valid
-		{"select count(*) from peoples;", parsedLine{Type: lastLineQuery, Tag: "", Value: "select count(*) from peoples"}},
-		{"select count(*)\nfrom pets   -- quantity of pets", parsedLine{Type: lineQuery, Tag: "", Value: "select count(*)\nfrom pets"}},
-		{"-- tag:name= Quantity of peoples", parsedLine{Type: lineName, Tag: "name", Value: "Quantity of peoples"}},
-		{"--tag : NAME= Quantity of pets", parsedLine{Type: lineName, Tag: "name", Value: "Quantity of pets"}},
-		{"-- tag: FileName= peoples.unl", parsedLine{Type: lineTag, Tag: "filename", Value: "peoples.unl"}},
-		{"--tag:FileName_2-KK= peoples.unl", parsedLine{Type: lineTag, Tag: "filename_2-kk", Value: "peoples.unl"}},
-		{"-- tag:= unknown 1", parsedLine{Type: lineComment, Tag: "", Value: ""}},
-		{"-- notas varias= 1) los commit son ignorados", parsedLine{Type: lineComment, Tag: "", Value: ""}},
-		{"-- kk= unknown 3", parsedLine{Type: lineComment, Tag: "", Value: ""}},
-		{"-- commit", parsedLine{Type: lineComment, Tag: "", Value: ""}},
-		{"-- coMMit", parsedLine{Type: lineComment, Tag: "", Value: ""}},
-		{"insert /*+ append */ into peoples select * from aux_peoples;", parsedLine{Type: lastLineQuery, Tag: "", Value: "insert /*+ append */ into peoples select * from aux_peoples"}},
-		// multiline comments are not supported yet
-		// {"select id, name from peoples /*  i will put the ; at the end of this comment", parsedLine{Type: lineQuery, Tag: "", Value: "select id, name from peoples"}},
-		// {"now the end of the comment and the ;*/;", parsedLine{Type: lineQuery, Tag: "", Value: ";"}},
+		{"", "", "", false},
+		{"-- tag:name= Quantity of peoples", "name", "Quantity of peoples", true},
+		{"--tag : NAME= Quantity of pets ", "name", "Quantity of pets", true},
+		{"-- tag: FileName= peoples.unl", "filename", "peoples.unl", true},
+		{"--tag:FileName_2-KK= peoples.unl\r", "filename_2-kk", "peoples.unl", true},
+		{"-- tag:param.refDate= date required", "param.refdate", "date required", true},
+		{"-- tag:= unknown 1", "", "", false},
+		{"-- notas varias= 1) los commit son ignorados", "", "", false},
+		{"-- kk= unknown 3", "", "", false},
+		{"-- commit", "", "", false},
 	}
 
 	for i, tt := range tests {
-		assert.Equal(t, tt.expected, parseLine(tt.feed), tt.feed, "Case: %d", i)
+		tag, value, ok := parseTag(tt.feed)
+		assert.Equal(t, tt.ok, ok, "Case: %d", i)
+		assert.Equal(t, tt.tag, tag, "Case: %d", i)
+		assert.Equal(t, tt.value, value, "Case: %d", i)
 	}
 }
 
@@ -48,49 +43,109 @@ create table TempSales as select * from Sales where CompanyID = :IDCompany;
 select * from TempSales;
 `
 	q, err := ParseFreeFileReader(strings.NewReader(fileRecord))
-	assert.Nil(t, err, "error: %v", err)
-	_ = q
+	if !assert.Nil(t, err, "error: %v", err) {
+		return
+	}
+	assert.Equal(t, 3, len(q))
+
+	assert.Equal(t, "select count(*) as Cant from Employees", q.Statement("query1"))
+	assert.Equal(t, DQL, q.QueryType("query1"))
+	assert.Equal(t, "query1", q.TagValue("query1", "name"))
+
+	assert.Equal(t, "create table TempSales as select * from Sales where CompanyID = :IDCompany", q.Statement("query2"))
+	assert.Equal(t, DDL, q.QueryType("query2"))
+
+	assert.Equal(t, "select * from TempSales", q.Statement(AutoName(2)))
+
+	iter := q.NewFileOrderIterator()
+	var names []string
+	for iter.Iterate() {
+		names = append(names, iter.TagValue("name"))
+	}
+	assert.Equal(t, []string{"query1", "query2", "query3"}, names)
+
+	q, err = ParseFreeFileReader(strings.NewReader("select 1 from dual;\n-- tag:owner= leo\nselect 2\n  from dual\n"))
+	if !assert.Nil(t, err, "error: %v", err) {
+		return
+	}
+	assert.Equal(t, 2, len(q))
+	assert.Equal(t, "select 2 from dual", q.Statement("query2"))
+	assert.Equal(t, "leo", q.TagValue("query2", "owner"))
+	assert.Equal(t, Position{Line: 4, Column: 11}, q.Query("query2").Source().End)
+
+	// the last statement is not kept when it ends inside a literal, an identifier, a comment or a block
+	for i, feed := range []string{
+		"select 1;\nselect * from \"",
+		"select 1;\nselect 'a; select 2;",
+		"select 1;\nselect 2 /* a; select 3;",
+		"select 1;\ncreate procedure p as begin\n  select 2;",
+	} {
+		q, err = ParseOptions{AllErrors: true}.ParseFreeFileReader(strings.NewReader(feed))
+		assert.Equal(t, "2:1: statement without terminator", fmt.Sprint(err), "Case: %d", i)
+		assert.Equal(t, 1, len(q), "Case: %d", i)
+	}
+}
+
+func TestParseQueryFileWithTags(t *testing.T) {
+	fileRecord := `
+-- just a comment
+select 1 from dual;
+-- tag:name= Cities
+select * from cities;
+-- tag:fileName= peoples.psv
+select * from peoples;
+commit;
+`
+	q, err := ParseFreeFileReader(strings.NewReader(fileRecord))
+	if !assert.Nil(t, err, "error: %v", err) {
+		return
+	}
+	assert.Equal(t, 3, len(q))
+	assert.Equal(t, "select 1 from dual", q.Statement("query1"))
+	assert.Equal(t, "select * from cities", q.Statement("cities"))
+	assert.Equal(t, "select * from peoples", q.Statement("query3"))
+	assert.Equal(t, "peoples.psv", q.TagValue("query3", "filename"))
+
+	// the generated names skip the ones taken by the name tags
+	q, err = ParseOptions{AllErrors: true}.ParseFreeFileReader(strings.NewReader("-- tag:name= query2\nselect 1 from dual;\nselect 2 from dual;\nselect 3 from dual;\nselect 4 from dual;"))
+	if !assert.Nil(t, err, "error: %v", err) {
+		return
+	}
+	assert.Equal(t, 4, len(q))
+	assert.Equal(t, "select 1 from dual", q.Statement("query2"))
+	assert.Equal(t, "select 2 from dual", q.Statement("query3"))
+	assert.Equal(t, "select 3 from dual", q.Statement("query4"))
+	assert.Equal(t, "select 4 from dual", q.Statement("query5"))
 }
 
 func TestQueryTerminator(t *testing.T) {
 	var tests = []struct {
 		feed     string
-		expected bool
+		expected string
 	}{
-		{"", false},
-		{";", true},
-		{";--comment at the end", true},
-		{"select count(*) from peoples", false},
-		{"select count(*) from peoples;", true},
-		{"select count(*) from peoples; -- people count", true},
-		{"select count(*) from peoples -- people count;", false},
-		{"/*", false},
-		{"*/", false},
-		{"/* comment */", false},
-		{"now the end of the comment and the ;/*;", true},
-		{"now the end of the comment and the ;*/;", true},
-		{"now the end of the comment and the ;/**/;", true},
-		{"insert /*+ append */ into peoples select * from aux_peoples;", true},
-		{"select id, name from peoples; /* comment", true},
-		{"select id, name from peoples /* comment */;", true},
-		{"select id, name from peoples; /* comment */", true},
-		{"select id, name from peoples /* comment; */", false},
-		{"select id, name from peoples /* comment ;", false},
+		{"select count(*) from peoples;", "select count(*) from peoples"},
+		{"select count(*) from peoples; -- people count", "select count(*) from peoples"},
+		{"select count(*) from peoples -- people count;\n;", "select count(*) from peoples"},
+		{"select count(*)\nfrom pets   -- quantity of pets\n;", "select count(*) from pets"},
+		{"insert /*+ append */ into peoples select * from aux_peoples;", "insert /*+ append */ into peoples select * from aux_peoples"},
+		{"select id, name from peoples /* comment */;", "select id, name from peoples /* comment */"},
+		{"select id, name from peoples /* comment; */ where id = 1;", "select id, name from peoples /* comment; */ where id = 1"},
+		{"select id, name from peoples /*  i will put the ; at the end of this comment\nnow the end of the comment and the ;*/;", "select id, name from peoples /*  i will put the ; at the end of this comment now the end of the comment and the ;*/"},
+		{"select id from peoples /* outer /* inner; */ still a comment; */;", "select id from peoples /* outer /* inner; */ still a comment; */"},
+		{"select 'a--b;' from dual;", "select 'a--b;' from dual"},
+		{"select 'it''s; -- ok' from dual;", "select 'it''s; -- ok' from dual"},
+		{"select E'it\\'s;' from dual;", "select E'it\\'s;' from dual"},
+		{"select \"a;b\", `c--d` from dual;", "select \"a;b\", `c--d` from dual"},
+		{"select 'first line;\n  second line' from dual;", "select 'first line;\n  second line' from dual"},
 	}
 
 	for i, tt := range tests {
-		assert.Equal(t, tt.expected, isQueryLastLine(tt.feed), tt.feed, "Case: %d", i)
-	}
-}
-
-var resultIQLL bool
-
-func BenchmarkIsQueryLastLine(b *testing.B) {
-	var r bool
-	for i := 0; i < b.N; i++ {
-		r = isQueryLastLine("insert /*+ append */ into peoples select * from aux_peoples;")
+		got, err := ParseReader(strings.NewReader("-- tag:name= test\n" + tt.feed))
+		if !assert.Nil(t, err, "Case: %d", i) {
+			continue
+		}
+		assert.Equal(t, tt.expected, got.Statement("test"), tt.feed, "Case: %d", i)
 	}
-	resultIQLL = r
 }
 
 func TestScapeColons(t *testing.T) {
@@ -99,63 +154,74 @@ func TestScapeColons(t *testing.T) {
 		expected string
 	}{
 		{"", ""},
-		{":", ":"},
+		{":", "::"},
 		{"a", "a"},
 		{"to_char(sysdate,'HH24:MM:SS')", "to_char(sysdate,'HH24::MM::SS')"},
 		{"to_char(sysdate,'HH24:MM:SS') and DoctorID = :DoctorID and Status = :Status order by PatientID", "to_char(sysdate,'HH24::MM::SS') and DoctorID = :DoctorID and Status = :Status order by PatientID"},
-		{"a:", "a:"},
+		{"a:", "a::"},
 		{"a:b", "a:b"},
-		{":a=:b:", ":a=:b:"},
-		{":=:", ":=:"},
+		{":a=:b:", ":a=:b::"},
+		{":=:", "::=::"},
 		{"f=t(':", "f=t('::"},
 		{"con.Fecha = to_date(:FechaIni, 'YYYYMMDD')", "con.Fecha = to_date(:FechaIni, 'YYYYMMDD')"},
 		{"con.FechaHora = to_date(:FechaHoraIni, 'YYYYMMDD HH:MI::SS')", "con.FechaHora = to_date(:FechaHoraIni, 'YYYYMMDD HH::MI::SS')"},
 		{"con.Cen_ID = :CenterID and con.Fecha between to_date(:FechaIni, 'YYYYMMDD') and to_date(:FechaFin, 'YYYYMMDD')", "con.Cen_ID = :CenterID and con.Fecha between to_date(:FechaIni, 'YYYYMMDD') and to_date(:FechaFin, 'YYYYMMDD')"},
 		{"con.Cen_ID = :CenterID and con.Fecha between to_date(:FechaIni, 'YYYYMMDD HH:MI:SS') and to_date(:FechaFin, 'YYYYMMDD HH24:MI:SS')", "con.Cen_ID = :CenterID and con.Fecha between to_date(:FechaIni, 'YYYYMMDD HH::MI::SS') and to_date(:FechaFin, 'YYYYMMDD HH24::MI::SS')"},
+		{"select x::int, y::text from t where z = :z", "select x::::int, y::::text from t where z = :z"},
+		{"select a[1:2], b := :1", "select a[1::2], b ::= ::1"},
+		{"select \"a:b\" from t -- :c\n", "select \"a::b\" from t -- ::c\n"},
+		{"select $$ :x $$ /* :y */", "select $$ ::x $$ /* ::y */"},
 	}
 
 	for i, tt := range tests {
-		assert.Equal(t, tt.expected, scapeColons(tt.feed), tt.feed, "Case: %d", i)
-	}
-}
-
-var resultSC string
-
-func BenchmarkScapeColon(b *testing.B) {
-	var r string
-	for i := 0; i < b.N; i++ {
-		scapeColons("select to_char(sysdate,'HH24:MM:SS'), to_date('2020-05-23 17:18:19','YYYY-MM-DD HH24:MM:SS') from peoples where peopleID = :IDPeople and peopleName=peopleName")
+		assert.Equal(t, tt.expected, scapeColons(tt.feed, false), tt.feed, "Case: %d", i)
 	}
-	resultSC = r
 }
 
-func TestSqlType(t *testing.T) {
+func TestEscaper(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+select Birth::date, to_char(Birth, 'HH24:MI') from peoples where ID = :ID;
+-- tag:name= CreateView
+create view peoplesVW as select to_char(Birth, 'HH24:MI') t from peoples;
+`
 	var tests = []struct {
-		feed     string
-		expected int
+		escaper  Escaper
+		peoples  string
+		viewStmt string
 	}{
-		{"", UKN},
-		{"select * from dual;", DQL},
-		{"create index KKX1 on KK(ID);", DDL},
-		{"delete from KK where ID = 1;", DML},
-		{"drop table", DDL},
-		{"-- select 1 from dual;", UKN},
-		{"with aux_agendas as (select test_id from dual) select * from aux_agendas;", DQL},
+		{nil, "select Birth::::date, to_char(Birth, 'HH24::MI') from peoples where ID = :ID", "create view peoplesVW as select to_char(Birth, 'HH24::MI') t from peoples"},
+		{SqlxEscaper, "select Birth::::date, to_char(Birth, 'HH24::MI') from peoples where ID = :ID", "create view peoplesVW as select to_char(Birth, 'HH24::MI') t from peoples"},
+		{NoEscaper, "select Birth::date, to_char(Birth, 'HH24:MI') from peoples where ID = :ID", "create view peoplesVW as select to_char(Birth, 'HH24:MI') t from peoples"},
+		{strings.ToUpper, "SELECT BIRTH::DATE, TO_CHAR(BIRTH, 'HH24:MI') FROM PEOPLES WHERE ID = :ID", "CREATE VIEW PEOPLESVW AS SELECT TO_CHAR(BIRTH, 'HH24:MI') T FROM PEOPLES"},
 	}
 
 	for i, tt := range tests {
-		assert.Equal(t, tt.expected, sqlType(tt.feed), tt.feed, "Case:", i)
+		queries, err := ParseOptions{Escaper: tt.escaper}.ParseReader(strings.NewReader(sqlFile))
+		if !assert.Nil(t, err, "error not expected: %v - Case: %d", err, i) {
+			continue
+		}
+		assert.Equal(t, tt.peoples, queries.Statement("peoples"), "Case: %d", i)
+		assert.Equal(t, tt.viewStmt, queries.Statement("createview"), "Case: %d", i)
+		assert.Equal(t, "select Birth::date, to_char(Birth, 'HH24:MI') from peoples where ID = :ID", queries.Query("peoples").Raw(), "Case: %d", i)
+	}
+
+	queries, err := ParseOptions{Verbatim: true, Escaper: NoEscaper}.ParseReader(strings.NewReader("-- tag:name= Peoples\nselect x::int\n  from peoples; -- :c"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
 	}
+	assert.Equal(t, "select x::int\n  from peoples", queries.Statement("peoples"))
+	assert.Equal(t, "select x::int\n  from peoples", queries.Query("peoples").Raw())
+	assert.Equal(t, "select x::int from peoples", queries.Query("peoples").Normalized())
 }
 
-var resultST int
+var resultSC string
 
-func BenchmarkSqlType(b *testing.B) {
-	var r int
+func BenchmarkScapeColon(b *testing.B) {
+	var r string
 	for i := 0; i < b.N; i++ {
-		r = sqlType("drop table KK;")
+		scapeColons("select to_char(sysdate,'HH24:MM:SS'), to_date('2020-05-23 17:18:19','YYYY-MM-DD HH24:MM:SS') from peoples where peopleID = :IDPeople and peopleName=peopleName", false)
 	}
-	resultST = r
+	resultSC = r
 }
 
 type Feed struct {
@@ -167,6 +233,43 @@ func (f Feed) String() string {
 	return fmt.Sprintf("-- tag:name= %s\n%s\n", f.name, f.query)
 }
 
+func TestQueryKind(t *testing.T) {
+	var tests = []struct {
+		feed     string
+		expected QueryKind
+		err      bool
+	}{
+		{"DML", DML, false},
+		{"dql", DQL, false},
+		{" Ddl ", DDL, false},
+		{"PRC", PRC, false},
+		{"UKN", UKN, false},
+		{"select", UKN, true},
+		{"", UKN, true},
+	}
+
+	for i, tt := range tests {
+		kind, err := ParseQueryKind(tt.feed)
+		assert.Equal(t, tt.expected, kind, "Case: %d", i)
+		assert.Equal(t, tt.err, err != nil, "Case: %d - %v", i, err)
+	}
+
+	assert.Equal(t, "DQL", DQL.String())
+	assert.Equal(t, "QueryKind(42)", QueryKind(42).String())
+
+	b, err := json.Marshal(map[string]QueryKind{"peoples": DQL, "addPeople": DML})
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, `{"addPeople":"DML","peoples":"DQL"}`, string(b))
+
+	var kinds map[string]QueryKind
+	assert.Nil(t, json.Unmarshal([]byte(`{"a":"ddl","b":"TCL"}`), &kinds))
+	assert.Equal(t, map[string]QueryKind{"a": DDL, "b": TCL}, kinds)
+	assert.NotNil(t, json.Unmarshal([]byte(`{"a":"bogus"}`), &kinds))
+
+	_, err = json.Marshal(QueryKind(-1))
+	assert.NotNil(t, err)
+}
+
 func TestParseReader(t *testing.T) {
 
 	var tests = []struct {
@@ -216,6 +319,14 @@ func TestParseReaderMultiQueries(t *testing.T) {
 		Type:  DQL,
 		Tags:  tags,
 		idx:   0,
+		src: Source{
+			Start: Position{Line: 6, Column: 1},
+			End:   Position{Line: 6, Column: 28},
+			Text:  "select PeopleID from Peoples",
+		},
+		norm:  "select PeopleID from Peoples",
+		kind:  Select,
+		txSeq: 1,
 	}
 
 	tags = make(map[string]string)
@@ -229,6 +340,15 @@ func TestParseReaderMultiQueries(t *testing.T) {
 		Type:  DQL,
 		Tags:  tags,
 		idx:   1,
+		src: Source{
+			Start: Position{Line: 15, Column: 1},
+			End:   Position{Line: 17, Column: 28},
+			Text:  "select CityID\nfrom cities -- city table\nwhere CountryID = :CountryID",
+		},
+		norm:       "select CityID from cities where CountryID = :CountryID",
+		kind:       Select,
+		txSeq:      2,
+		txRollback: true,
 	}
 
 	var tests = []struct {
@@ -287,6 +407,25 @@ rollback;
 	}
 }
 
+func TestParseReaderTransactionControl(t *testing.T) {
+	fileRecords := `
+-- tag:name= Insert1
+insert into peoples values (1);
+commit
+-- tag:name= Insert2
+insert into peoples values (2);
+  rollback -- rollback de los cambios
+-- tag:name= Insert3
+insert into peoples values (3);
+COMMIT;
+`
+	queries, err := ParseReader(strings.NewReader(fileRecords))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 3, len(queries))
+	assert.Equal(t, "insert into peoples values (2)", queries.Statement("Insert2"))
+	assert.Equal(t, "insert into peoples values (3)", queries.Statement("Insert3"))
+}
+
 func TestHelpers(t *testing.T) {
 	fileRecords := `
 --tag:name=Cities
@@ -319,3 +458,283 @@ select PeopleID from Peoples;
 
 	assert.Equal(t, UKN, queries.QueryType("KK"), "KK")
 }
+
+func TestParseReaderLongLines(t *testing.T) {
+	var values strings.Builder
+	values.WriteString("insert into peoples (ID, Name) values (0, 'Leo')")
+	for i := 1; values.Len() < 200*1024; i++ {
+		fmt.Fprintf(&values, ", (%d, 'Leo')", i)
+	}
+	literal := strings.Repeat("x;-", 100*1024)
+
+	sqlFile := fmt.Sprintf(`
+-- tag:name= Insert1
+%s;
+-- tag:name= Select1
+select '%s' from dual;
+-- tag:name= Select2
+select * from peoples;
+`, values.String(), literal)
+
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, 3, len(queries))
+	assert.Equal(t, values.String(), queries.Statement("insert1"))
+	assert.Equal(t, "select '"+literal+"' from dual", queries.Statement("select1"))
+	assert.Equal(t, "select * from peoples", queries.Statement("select2"))
+}
+
+func TestParseReaderDelimiters(t *testing.T) {
+	sqlFile := `
+-- tag:name= Table1
+create table peoples (ID int, Name varchar(50));
+
+DELIMITER //
+-- tag:name= Procedure1
+create procedure add_people(in id int)
+begin
+  insert into peoples (ID) values (id);
+  update counters set qty = qty + 1;
+end//
+-- tag:name= Select1
+select * from peoples//
+DELIMITER ;
+
+-- tag:name= OraBlock
+-- tag:delimiter= /
+create or replace procedure touch is
+  v number;
+begin
+  update peoples set Name = Name;
+end;
+/
+-- tag:name= Select2
+select 2 from dual;
+
+-- tag:name= Trigger1
+-- tag:delimiter= $$
+create trigger t1 before insert on peoples for each row begin set new.Name = upper(new.Name); end$$
+-- tag:name= Select3
+select 3 from dual;
+
+-- tag:name= Batch1
+-- tag:delimiter= GO
+declare @x int;
+set @x = 1;
+GO
+-- tag:name= Batch2
+select 4
+go
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+
+	assert.Equal(t, 9, len(queries))
+	assert.Equal(t, "create table peoples (ID int, Name varchar(50))", queries.Statement("table1"))
+	assert.Equal(t, "create procedure add_people(in id int) begin insert into peoples (ID) values (id); update counters set qty = qty + 1; end", queries.Statement("procedure1"))
+	assert.Equal(t, "select * from peoples", queries.Statement("select1"))
+	assert.Equal(t, "create or replace procedure touch is v number; begin update peoples set Name = Name; end;", queries.Statement("orablock"))
+	assert.Equal(t, "select 2 from dual", queries.Statement("select2"))
+	assert.Equal(t, "create trigger t1 before insert on peoples for each row begin set new.Name = upper(new.Name); end", queries.Statement("trigger1"))
+	assert.Equal(t, "select 3 from dual", queries.Statement("select3"))
+	assert.Equal(t, "declare @x int; set @x = 1;", queries.Statement("batch1"))
+	assert.Equal(t, "select 4", queries.Statement("batch2"))
+
+	_, err = ParseReader(strings.NewReader("-- tag:name= Test1\n-- tag:delimiter=\nselect 1 from dual;"))
+	assert.Equal(t, &ParseError{Kind: InvalidTag, Pos: Position{Line: 2, Column: 1}, Query: "Test1", Msg: `tag "delimiter" without value`}, err)
+}
+
+func TestParseReaderSharedLine(t *testing.T) {
+	sqlFile := `
+-- tag:name= Clean
+-- tag:fileName= clean.log
+delete from a; delete from b where c = ';'; delete /* ; */ from d;
+-- tag:name= Insert1
+insert into peoples
+  values (1); commit; insert into peoples values (2); -- second one
+select * from skipped;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+
+	var names, statements []string
+	iter := queries.NewFileOrderIterator()
+	for iter.Iterate() {
+		names = append(names, iter.TagValue("name"))
+		statements = append(statements, iter.Statement())
+	}
+	assert.Equal(t, []string{"Clean", "Clean_2", "Clean_3", "Insert1", "Insert1_2"}, names)
+	assert.Equal(t, []string{
+		"delete from a",
+		"delete from b where c = ';'",
+		"delete /* ; */ from d",
+		"insert into peoples values (1)",
+		"insert into peoples values (2)",
+	}, statements)
+	assert.Equal(t, "clean.log", queries.TagValue("clean_3", "fileName"))
+	assert.Equal(t, Position{Line: 4, Column: 16}, queries.Query("clean_2").Source().Start)
+
+	// the tags about the statement are not copied, every sibling is classified from its own statement
+	queries, err = ParseReader(strings.NewReader("-- tag:name= Mixed\n-- tag:type= DML\n-- tag:concurrent= false\n-- tag:owner= leo\n-- tag:owner= ana\ndelete from a; select 1 from b;"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	q := queries.Query("mixed_2")
+	assert.Equal(t, map[string]string{"name": "Mixed_2", "owner": "ana"}, q.Tags)
+	assert.Equal(t, []string{"leo", "ana"}, q.TagValues("owner"))
+	assert.Equal(t, DQL, q.Type)
+	assert.True(t, q.Concurrent())
+	assert.False(t, queries.Query("mixed").Concurrent())
+
+	_, err = ParseReader(strings.NewReader("-- tag:name= Test1\nselect 1 from dual; select 2 from dual"))
+	assert.Equal(t, &ParseError{Kind: UnterminatedQuery, Pos: Position{Line: 2, Column: 21}, Msg: "statement without terminator"}, err)
+
+	_, err = ParseOptions{Strict: true}.ParseReader(strings.NewReader("-- tag:name= Test1\nselect 1 from dual; select 2 from dual;"))
+	assert.Equal(t, &ParseError{Kind: SharedLine, Pos: Position{Line: 2, Column: 21}, Query: "Test1", Msg: `several statements under the name tag "Test1"`}, err)
+
+	_, err = ParseReader(strings.NewReader("-- tag:name= Test1\nselect 1 from dual; select 2 from dual;\n-- tag:name= Test1_2\nselect 3 from dual;"))
+	assert.Equal(t, &ParseError{Kind: DuplicatedName, Pos: Position{Line: 3, Column: 1}, Query: "Test1_2", Msg: `duplicated query name: "test1_2"`}, err)
+}
+
+func TestParseReaderVerbatim(t *testing.T) {
+	sqlFile := `
+-- tag:name= Select1
+select /*+ index(p peoX1) */ p.Name,
+       to_char(p.Birth, 'HH24:MI') -- birth time
+  from peoples p;
+-- tag:name= Create1
+create table peoples2 as
+  select * from peoples; -- copy
+`
+	queries, err := ParseOptions{Verbatim: true}.ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+
+	q := queries.Query("select1")
+	assert.Equal(t, "select /*+ index(p peoX1) */ p.Name,\n       to_char(p.Birth, 'HH24::MI') -- birth time\n  from peoples p", q.Statement())
+	assert.Equal(t, q.Verbatim(), q.Statement())
+	assert.Equal(t, "select /*+ index(p peoX1) */ p.Name, to_char(p.Birth, 'HH24::MI') from peoples p", q.Normalized())
+	assert.Equal(t, DQL, q.QueryType())
+
+	q = queries.Query("create1")
+	assert.Equal(t, "create table peoples2 as\n  select * from peoples", q.Statement())
+	assert.Equal(t, "create table peoples2 as select * from peoples", q.Normalized())
+	assert.Equal(t, DDL, q.QueryType())
+
+	queries, err = ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	q = queries.Query("select1")
+	assert.Equal(t, q.Normalized(), q.Statement())
+	assert.Equal(t, "select /*+ index(p peoX1) */ p.Name,\n       to_char(p.Birth, 'HH24::MI') -- birth time\n  from peoples p", q.Verbatim())
+}
+
+func TestParseReaderBackslashEscapes(t *testing.T) {
+	sqlFile := `-- tag:name= Insert1
+insert into notes values (:id, 'it\'s; 10:30');
+-- tag:name= Select1
+select * from notes where note <> 'it\'s';
+`
+	// by default the first literal ends at \' and the rest of the file is split in the wrong places
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, "insert into notes values (:id, 'it\\'s", queries.Query("insert1").Raw())
+	assert.Nil(t, queries.Query("select1"))
+
+	queries, err = ParseOptions{BackslashEscapes: true}.ParseReader(strings.NewReader(sqlFile))
+
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, 2, len(queries))
+	q := queries.Query("insert1")
+	assert.Equal(t, "insert into notes values (:id, 'it\\'s; 10::30')", q.Statement())
+	assert.Equal(t, DML, q.Type)
+	assert.Equal(t, []string{"notes"}, q.Tables().Modifies)
+	stmt, names := q.Rebind(QuestionBind)
+	assert.Equal(t, "insert into notes values (?, 'it\\'s; 10:30')", stmt)
+	assert.Equal(t, []string{"id"}, names)
+	assert.Equal(t, "select * from notes where note <> 'it\\'s'", queries.Statement("select1"))
+}
+
+func TestQueryTransaction(t *testing.T) {
+	sqlFile := `
+-- tag:name= Insert1
+insert into countries values (1);
+-- tag:name= Insert2
+insert into cities values (1);
+COMMIT;
+-- tag:name= Insert3
+-- tag:tx= load_1
+insert into peoples values (1);
+-- tag:name= Insert4
+insert into provinces values (1);
+rollback to savepoint before_regions;
+-- tag:name= Insert5
+insert into regions values (1);
+rollback;
+-- tag:name= Insert6
+insert into regions values (2);
+commit;
+-- tag:name= Select1
+select * from regions;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	var tests = []struct {
+		name     string
+		expected string
+	}{
+		{"insert1", "commit#1"},
+		{"insert2", "commit#1"},
+		{"insert3", "load_1"},
+		{"insert4", "rollback#2"},
+		{"insert5", "rollback#2"},
+		{"insert6", "commit#3"},
+		{"select1", ""},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.expected, queries.Query(tt.name).Transaction(), "Case: %d", i)
+	}
+	assert.Equal(t, "", Query{Query: "select 1"}.Transaction())
+
+	// the queries of a tagged transaction must be together in strict mode
+	sqlFile = `
+-- tag:name= Insert1
+-- tag:tx= t1
+insert into a values (1);
+-- tag:name= Create1
+create table b (id int);
+-- tag:name= Insert2
+-- tag:tx= t1
+insert into b values (1);
+-- tag:name= Insert3
+-- tag:tx= t1
+insert into b values (2);
+`
+	_, err = ParseOptions{Strict: true}.ParseReader(strings.NewReader(sqlFile))
+	assert.Equal(t, &ParseError{Kind: SplitTransaction, Pos: Position{Line: 9, Column: 1}, Query: "Insert2", Msg: `query "Insert2" is separated by other queries from its transaction "t1"`}, err)
+	_, err = ParseReader(strings.NewReader(sqlFile))
+	assert.Nil(t, err, "error not expected: %v", err)
+
+	// a tagged query ends the transaction of the untagged ones, a rollback to a savepoint does not end it
+	// and the transaction control statements could have any blank between their words
+	queries, err = ParseFreeFileReader(strings.NewReader("select 1;\n-- tag:tx= t1\nselect 2;\nselect 3;\nrollback work to savepoint s;\nselect 4;\ncommit\twork;\nselect 5;"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	assert.Equal(t, 5, len(queries))
+	for i, expected := range []string{"commit#1", "t1", "commit#2", "commit#2", ""} {
+		assert.Equal(t, expected, queries.Query(AutoName(i)).Transaction(), "Case: %d", i)
+	}
+}
@@ -0,0 +1,132 @@
+package sqlmaper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CycleError is returned when the queries depend on each other, Queries has the names of the
+// queries of the cycle, the first one is repeated at the end (a -> b -> a)
+type CycleError struct {
+	Queries []string
+}
+
+// Error satisfy error interface
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle between queries: %s", strings.Join(e.Queries, " -> "))
+}
+
+// Stages returns the names of the queries grouped in execution stages, every query of a stage only
+// depends on queries of the previous stages so all of them could run in parallel (DML and DDL too).
+// The queries of a stage are in the order of the file. A CycleError is returned when the queries
+// depend on each other
+func (g *Graph) Stages() ([][]string, error) {
+	pending := make(map[string]int, len(g.names)) // dependencies not satisfied of each query
+	for _, name := range g.names {
+		pending[strings.ToLower(name)] = len(g.deps[strings.ToLower(name)])
+	}
+
+	var stages [][]string
+	done := 0
+	for done < len(g.names) {
+		var stage []string
+		for _, name := range g.names {
+			if n, ok := pending[strings.ToLower(name)]; ok && n == 0 {
+				stage = append(stage, name)
+			}
+		}
+		if len(stage) == 0 {
+			return stages, &CycleError{Queries: g.cycle(pending)}
+		}
+
+		for _, name := range stage {
+			delete(pending, strings.ToLower(name))
+		}
+		for _, name := range stage {
+			for _, dependent := range g.Dependents(name) {
+				pending[strings.ToLower(dependent)]--
+			}
+		}
+		stages = append(stages, stage)
+		done += len(stage)
+	}
+	return stages, nil
+}
+
+// cycle returns the names of a cycle among the queries that could not be staged
+func (g *Graph) cycle(pending map[string]int) []string {
+	var start string
+	for _, name := range g.names {
+		if _, ok := pending[strings.ToLower(name)]; ok {
+			start = name
+			break
+		}
+	}
+
+	// every pending query depends on a pending query, so following them always ends in a cycle
+	var path []string
+	seen := make(map[string]int)
+	for name := start; ; {
+		if i, ok := seen[strings.ToLower(name)]; ok {
+			return append(path[i:], name)
+		}
+		seen[strings.ToLower(name)] = len(path)
+		path = append(path, name)
+		for _, dep := range g.DependsOn(name) {
+			if _, ok := pending[strings.ToLower(dep)]; ok {
+				name = dep
+				break
+			}
+		}
+	}
+}
+
+// StageIterator defines an iterator over the execution stages of the queries, see Graph.Stages
+type StageIterator struct {
+	queries Queries
+	stages  [][]string
+	idx     int
+}
+
+// NewStageIterator returns an iterator over the execution stages of the queries given by their
+// dependency graph, the error is the one of Queries.Graph or a CycleError
+func (q Queries) NewStageIterator() (*StageIterator, error) {
+	g, err := q.Graph()
+	if err != nil {
+		return nil, err
+	}
+	stages, err := g.Stages()
+	if err != nil {
+		return nil, err
+	}
+	return &StageIterator{queries: q, stages: stages, idx: -1}, nil
+}
+
+// Iterate iterates over the stages
+func (s *StageIterator) Iterate() bool {
+	s.idx++
+	return s.idx < len(s.stages)
+}
+
+// Stage returns the number of the stage fetched in the last iteration, starting at 0
+func (s *StageIterator) Stage() int {
+	return s.idx
+}
+
+// Names returns the names of the queries of the stage fetched in the last iteration
+func (s *StageIterator) Names() []string {
+	return append([]string(nil), s.stages[s.idx]...)
+}
+
+// Queries returns an Iterator over the queries of the stage fetched in the last iteration,
+// all of them could run in parallel
+func (s *StageIterator) Queries() *Iterator {
+	names := make([]string, len(s.stages[s.idx]))
+	for i, name := range s.stages[s.idx] {
+		names[i] = strings.ToLower(name)
+	}
+	return &Iterator{queries: s.queries,
+		orderedNames: names,
+		idNames:      -1,
+	}
+}
@@ -0,0 +1,96 @@
+package sqlmaper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageIterator(t *testing.T) {
+	sqlFile := `
+-- tag:name= TempPersons
+create table TempPersons as select PersonID, BirthDate from Persons;
+-- tag:name= ExportPersons
+select PersonID, BirthDate from Persons;
+-- tag:name= TempPersonsIndex
+create index tempperX1 on TempPersons(BirthDate);
+-- tag:name= UpdateStocks
+update Stocks set qty = 0 where qty = -1;
+-- tag:name= SalesVW
+create view SalesVW as select ClientID, Amount from Sales;
+-- tag:name= Sales
+select ClientID, Amount from SalesVW;
+-- tag:name= Report
+-- tag:depends= Sales
+select count(*) from TempPersons;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	iter, err := queries.NewStageIterator()
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+
+	var stages [][]string
+	for iter.Iterate() {
+		assert.Equal(t, len(stages), iter.Stage())
+		stages = append(stages, iter.Names())
+
+		var names []string
+		qi := iter.Queries()
+		for qi.Iterate() {
+			names = append(names, qi.TagValue("name"))
+		}
+		assert.Equal(t, iter.Names(), names)
+	}
+	assert.Equal(t, [][]string{
+		{"TempPersons", "ExportPersons", "UpdateStocks", "SalesVW"},
+		{"TempPersonsIndex", "Sales"},
+		{"Report"},
+	}, stages)
+}
+
+func TestStagesCycle(t *testing.T) {
+	sqlFile := `
+-- tag:name= Select1
+select * from peoples;
+-- tag:name= Load1
+-- tag:depends= Load3
+insert into cities select * from aux_cities;
+-- tag:name= Load2
+insert into countries select * from cities;
+-- tag:name= Load3
+-- tag:depends= Load2
+insert into groups select * from aux_groups;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	_, err = queries.NewStageIterator()
+	var cycle *CycleError
+	if !assert.True(t, errors.As(err, &cycle), "CycleError expected: %v", err) {
+		return
+	}
+	assert.Equal(t, []string{"Load1", "Load3", "Load2", "Load1"}, cycle.Queries)
+	assert.Equal(t, "dependency cycle between queries: Load1 -> Load3 -> Load2 -> Load1", err.Error())
+
+	g, err := queries.Graph()
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	stages, err := g.Stages()
+	assert.NotNil(t, err)
+	assert.Equal(t, [][]string{{"Select1"}}, stages)
+
+	queries, err = ParseReader(strings.NewReader("-- tag:name= Select1\n-- tag:depends= Missing\nselect 1 from dual;"))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	_, err = queries.NewStageIterator()
+	assert.True(t, errors.Is(err, ErrQueryNotFound), "ErrQueryNotFound expected: %v", err)
+}
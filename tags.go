@@ -0,0 +1,163 @@
+package sqlmaper
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTagNotFound - the query has not the tag
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrQueryNotFound - there is no query with the given name
+	ErrQueryNotFound = errors.New("query not found")
+)
+
+// LookupTag returns the value of the tag and reports if the query has it, so an empty tag
+// (-- tag:fileName=) could be told apart from a missing one
+func (q Query) LookupTag(tag string) (string, bool) {
+	v, ok := q.Tags[strings.ToLower(tag)]
+	return v, ok
+}
+
+// TagValues returns every value of a tag in the order they are in the file, a tag could be
+// repeated to give it several values (eg: several -- tag:depends= lines)
+func (q Query) TagValues(tag string) []string {
+	tag = strings.ToLower(tag)
+	if values, ok := q.multi[tag]; ok {
+		return append([]string(nil), values...)
+	}
+	if v, ok := q.Tags[tag]; ok {
+		return []string{v}
+	}
+	return nil
+}
+
+// TagBool returns the value of the tag as a bool (1, t, true, 0, f, false, etc)
+func (q Query) TagBool(tag string) (bool, error) {
+	v, err := q.tag(tag)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("tag %q: %w", tag, err)
+	}
+	return b, nil
+}
+
+// TagInt returns the value of the tag as an int
+func (q Query) TagInt(tag string) (int, error) {
+	v, err := q.tag(tag)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("tag %q: %w", tag, err)
+	}
+	return n, nil
+}
+
+// TagDuration returns the value of the tag as a duration (eg: 30s, 1m30s or 500ms)
+func (q Query) TagDuration(tag string) (time.Duration, error) {
+	v, err := q.tag(tag)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("tag %q: %w", tag, err)
+	}
+	return d, nil
+}
+
+// TagList returns the comma separated values of the tag (eg: -- tag:columns= ID, Name, Birth),
+// the values are trimmed and the empty ones are skipped
+func (q Query) TagList(tag string) ([]string, error) {
+	v, err := q.tag(tag)
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list, nil
+}
+
+// tag returns the trimmed value of the tag or ErrTagNotFound
+func (q Query) tag(tag string) (string, error) {
+	v, ok := q.LookupTag(tag)
+	if !ok {
+		return "", fmt.Errorf("query %q: %w: %q", q.Tags["name"], ErrTagNotFound, strings.ToLower(tag))
+	}
+	return strings.TrimSpace(v), nil
+}
+
+// LookupTag is a helper to obtain the tag value of a given query and to know if it has the tag
+func (q Queries) LookupTag(label, tag string) (string, bool) {
+	qry, ok := q[strings.ToLower(label)]
+	if !ok {
+		return "", false
+	}
+	return qry.LookupTag(tag)
+}
+
+// TagValues is a helper to obtain every value of a given query tag
+func (q Queries) TagValues(label, tag string) []string {
+	qry, ok := q[strings.ToLower(label)]
+	if !ok {
+		return nil
+	}
+	return qry.TagValues(tag)
+}
+
+// TagBool is a helper to obtain the tag value of a given query as a bool
+func (q Queries) TagBool(label, tag string) (bool, error) {
+	qry, err := q.query(label)
+	if err != nil {
+		return false, err
+	}
+	return qry.TagBool(tag)
+}
+
+// TagInt is a helper to obtain the tag value of a given query as an int
+func (q Queries) TagInt(label, tag string) (int, error) {
+	qry, err := q.query(label)
+	if err != nil {
+		return 0, err
+	}
+	return qry.TagInt(tag)
+}
+
+// TagDuration is a helper to obtain the tag value of a given query as a duration
+func (q Queries) TagDuration(label, tag string) (time.Duration, error) {
+	qry, err := q.query(label)
+	if err != nil {
+		return 0, err
+	}
+	return qry.TagDuration(tag)
+}
+
+// TagList is a helper to obtain the comma separated tag values of a given query
+func (q Queries) TagList(label, tag string) ([]string, error) {
+	qry, err := q.query(label)
+	if err != nil {
+		return nil, err
+	}
+	return qry.TagList(tag)
+}
+
+// query returns the query with the given name or ErrQueryNotFound
+func (q Queries) query(label string) (*Query, error) {
+	qry, ok := q[strings.ToLower(label)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrQueryNotFound, strings.ToLower(label))
+	}
+	return qry, nil
+}
@@ -0,0 +1,127 @@
+package sqlmaper
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagAccessors(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+-- tag:retries= 3
+-- tag:timeout= 1m30s
+-- tag:cache= true
+-- tag:columns= ID, Name,, Birth
+-- tag:fileName=
+-- tag:bad= many
+select * from peoples;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	q := queries.Query("peoples")
+
+	v, ok := q.LookupTag("FileName")
+	assert.True(t, ok)
+	assert.Equal(t, "", v)
+	_, ok = q.LookupTag("missing")
+	assert.False(t, ok)
+
+	n, err := q.TagInt("retries")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 3, n)
+
+	d, err := q.TagDuration("Timeout")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 90*time.Second, d)
+
+	b, err := q.TagBool("cache")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.True(t, b)
+
+	list, err := q.TagList("columns")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []string{"ID", "Name", "Birth"}, list)
+
+	list, err = q.TagList("filename")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Nil(t, list)
+
+	_, err = q.TagInt("missing")
+	assert.True(t, errors.Is(err, ErrTagNotFound), "ErrTagNotFound expected: %v", err)
+	assert.Equal(t, `query "Peoples": tag not found: "missing"`, err.Error())
+
+	_, err = q.TagInt("bad")
+	assert.True(t, errors.Is(err, strconv.ErrSyntax), "syntax error expected: %v", err)
+	_, err = q.TagBool("bad")
+	assert.NotNil(t, err)
+	_, err = q.TagDuration("bad")
+	assert.NotNil(t, err)
+
+	v, ok = queries.LookupTag("PEOPLES", "retries")
+	assert.True(t, ok)
+	assert.Equal(t, "3", v)
+	_, ok = queries.LookupTag("cities", "retries")
+	assert.False(t, ok)
+
+	n, err = queries.TagInt("peoples", "retries")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 3, n)
+	d, err = queries.TagDuration("peoples", "timeout")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, 90*time.Second, d)
+	b, err = queries.TagBool("peoples", "cache")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.True(t, b)
+	list, err = queries.TagList("peoples", "columns")
+	assert.Nil(t, err, "error not expected: %v", err)
+	assert.Equal(t, []string{"ID", "Name", "Birth"}, list)
+
+	_, err = queries.TagInt("cities", "retries")
+	assert.True(t, errors.Is(err, ErrQueryNotFound), "ErrQueryNotFound expected: %v", err)
+	assert.Equal(t, `query not found: "cities"`, err.Error())
+	_, err = queries.TagBool("cities", "cache")
+	assert.True(t, errors.Is(err, ErrQueryNotFound))
+	_, err = queries.TagDuration("cities", "timeout")
+	assert.True(t, errors.Is(err, ErrQueryNotFound))
+	_, err = queries.TagList("cities", "columns")
+	assert.True(t, errors.Is(err, ErrQueryNotFound))
+}
+
+func TestTagValues(t *testing.T) {
+	sqlFile := `-- tag:name= Peoples
+-- tag:depends= Groups
+-- tag:fileName= peoples.psv
+-- tag:Depends= Cities
+-- tag:depends= Countries
+select * from peoples; select * from peoplesVW;
+-- tag:name= Cities
+select * from cities;
+`
+	queries, err := ParseReader(strings.NewReader(sqlFile))
+	if !assert.Nil(t, err, "error not expected: %v", err) {
+		return
+	}
+	q := queries.Query("peoples")
+	assert.Equal(t, []string{"Groups", "Cities", "Countries"}, q.TagValues("depends"))
+	assert.Equal(t, "Countries", q.TagValue("depends"))
+	assert.Equal(t, []string{"peoples.psv"}, q.TagValues("filename"))
+	assert.Nil(t, q.TagValues("missing"))
+
+	values := q.TagValues("depends")
+	values[0] = "changed"
+	assert.Equal(t, "Groups", q.TagValues("depends")[0])
+
+	assert.Equal(t, []string{"Groups", "Cities", "Countries"}, queries.TagValues("peoples_2", "depends"))
+	assert.Equal(t, []string{"Cities"}, queries.TagValues("cities", "name"))
+	assert.Nil(t, queries.TagValues("countries", "name"))
+
+	iter := queries.NewFileOrderIterator()
+	assert.True(t, iter.Iterate())
+	assert.Equal(t, []string{"Groups", "Cities", "Countries"}, iter.TagValues("DEPENDS"))
+}